@@ -2,11 +2,13 @@ package osubot
 
 import (
 	"os"
+	"time"
 	"encoding/json"
 )
 
 type Cache struct {
-	Lobby string `json:"lobby"`
+	Lobby string                `json:"lobby"`
+	Bans map[string]time.Time   `json:"bans,omitempty"`
 }
 
 func (c *Cache) LoadFile(path string) error {
@@ -25,5 +27,5 @@ func (c Cache) SaveFile(path string) error {
 	if e != nil {
 		return e
 	}
-	return os.WriteFile(path, b, 0666)
+	return writeFileAtomic(path, b, 0666)
 }
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"flag"
+	"errors"
+	"log/slog"
+	"path/filepath"
+
+	"osubot"
+	"osubot/osu/irc"
+)
+
+type options struct {
+	configPath string
+	cachePath string
+	crashPath string
+	dataDir string
+	logLevel string
+}
+
+const usage = `Usage: osubot [flags] [command] [arguments]
+
+Commands:
+  run                  Start the bot (default)
+  init                 Create the config file from flags or environment variables
+  check-config [path]  Check the config file and exit
+  close-room           Close the room the bot was hosting and exit
+  encrypt-secrets      Encrypt the secrets in the config with a passphrase
+  replay file          Replay a recorded session
+
+Flags:
+`
+
+func (o *options) flags(fs *flag.FlagSet) {
+	fs.StringVar(&o.configPath, "config", o.configPath, "path to the config file (default \"" + configPath + "\" in the data directory)")
+	fs.StringVar(&o.dataDir, "data-dir", o.dataDir, "directory for the config, cache, crash reports and logs")
+	fs.StringVar(&o.logLevel, "log-level", o.logLevel, "override log.level: debug, info, warn or error")
+}
+
+func main() {
+	var o options
+	fs := flag.NewFlagSet("osubot", flag.ExitOnError)
+	o.flags(fs)
+	checkConfigFlag := fs.Bool("check-config", false, "deprecated alias for the check-config command")
+	fs.Usage = func(){
+		fmt.Fprint(fs.Output(), usage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(os.Args[1:])
+
+	command, args := "run", fs.Args()
+	if *checkConfigFlag {
+		command = "check-config"
+	} else if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	cmd := flag.NewFlagSet("osubot " + command, flag.ExitOnError)
+	o.flags(cmd)
+	var user, pass, id, secret string
+	var force bool
+	if command == "init" {
+		cmd.StringVar(&user, "user", "", "IRC username (default $OSUBOT_IRC_USER)")
+		cmd.StringVar(&pass, "password", "", "IRC password (default $OSUBOT_IRC_PASSWORD)")
+		cmd.StringVar(&id, "client-id", "", "OAuth client ID (default $OSUBOT_API_ID)")
+		cmd.StringVar(&secret, "client-secret", "", "OAuth client secret (default $OSUBOT_API_SECRET)")
+		cmd.BoolVar(&force, "force", false, "overwrite the existing config file")
+	}
+	cmd.Parse(args)
+	args = cmd.Args()
+	for v, env := range map[*string]string{
+		&user: "OSUBOT_IRC_USER",
+		&pass: "OSUBOT_IRC_PASSWORD",
+		&id: "OSUBOT_API_ID",
+		&secret: "OSUBOT_API_SECRET",
+	} {
+		if *v == "" {
+			*v = os.Getenv(env)
+		}
+	}
+
+	if e := o.resolve(); e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+	if o.logLevel != "" {
+		var level slog.Level
+		if e := level.UnmarshalText([]byte(o.logLevel)); e != nil {
+			fmt.Fprintln(os.Stderr, "--log-level:", e)
+			os.Exit(2)
+		}
+	}
+
+	var e error
+	switch {
+	case command == "run" && len(args) == 0:
+		e = run(o)
+	case command == "init" && len(args) == 0:
+		e = initConfig(o.configPath, user, pass, id, secret, force)
+	case command == "check-config" && len(args) <= 1:
+		path := o.configPath
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if !checkConfig(path) {
+			os.Exit(1)
+		}
+	case command == "close-room" && len(args) == 0:
+		e = closeRoom(o)
+	case command == "encrypt-secrets" && len(args) == 0:
+		e = encryptSecrets(o.configPath)
+	case command == "replay" && len(args) == 1:
+		var ok bool
+		if ok, e = replay(args[0]); e == nil && !ok {
+			os.Exit(1)
+		}
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+	if e != nil {
+		fmt.Fprintln(os.Stderr, e)
+		os.Exit(1)
+	}
+}
+
+func (o *options) resolve() error {
+	if o.dataDir != "" {
+		if o.configPath != "" {
+			var e error
+			if o.configPath, e = filepath.Abs(o.configPath); e != nil {
+				return e
+			}
+		}
+		if e := os.MkdirAll(o.dataDir, 0755); e != nil {
+			return e
+		}
+		if e := os.Chdir(o.dataDir); e != nil {
+			return e
+		}
+	}
+	if o.configPath == "" {
+		o.configPath = configPath
+	}
+	o.cachePath, o.crashPath = cachePath, crashPath
+	return nil
+}
+
+func initConfig(path, user, pass, id, secret string, force bool) error {
+	if _, e := os.Stat(path); e == nil && !force {
+		return fmt.Errorf("%v already exists, use --force to overwrite it", path)
+	}
+	c := osubot.DefaultConfig(user, pass, id, secret)
+	if e := c.Validate(); e != nil {
+		return fmt.Errorf("invalid config:\n%w", e)
+	}
+	if e := c.SaveFile(path); e != nil {
+		return e
+	}
+	fmt.Println("Created", path)
+	return nil
+}
+
+type roomCloser struct {
+	irc.BaseDispatcher
+	conn irc.Conn
+	lobby string
+	closed, missing bool
+	err error
+}
+
+func closeRoom(o options) error {
+	b := &Bot{ configPath: o.configPath, cachePath: o.cachePath, logLevel: o.logLevel }
+	if e := b.config.LoadFile(b.configPath); e != nil {
+		return e
+	}
+	if e := b.overrideConfig(&b.config); e != nil {
+		return e
+	}
+	if e := b.cache.LoadFile(b.cachePath); e != nil && !os.IsNotExist(e) {
+		return e
+	}
+	if b.cache.Lobby == "" {
+		return errors.New("There is no room to close")
+	}
+
+	conn, e := b.dialer().Connect(b.config.IRC.Addr, b.config.IRC.RateLimit)
+	if e != nil {
+		return e
+	}
+	defer conn.Close()
+	time.AfterFunc(30 * time.Second, func(){ conn.Close() })
+
+	r := &roomCloser{ conn: conn, lobby: b.cache.Lobby }
+	conn.Send("PASS", b.config.IRC.Pass)
+	conn.Send("NICK", b.config.IRC.User)
+	for m, e := conn.Recv(); e == nil; m, e = conn.Recv() {
+		if m.Cmd == "PING" {
+			conn.Send("PONG", m.Arg(0))
+			continue
+		}
+		irc.Dispatch(m, r)
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+	if !r.closed && !r.missing {
+		return errors.New("Timed out waiting for " + r.lobby + " to close")
+	}
+	b.cache.Lobby = ""
+	b.saveCache()
+	if r.missing {
+		fmt.Println(r.lobby, "is already closed")
+	} else {
+		fmt.Println("Closed", r.lobby)
+	}
+	return nil
+}
+
+func (r *roomCloser) OnAuthenticated() {
+	r.conn.Send("JOIN", r.lobby)
+}
+
+func (r *roomCloser) OnAuthenticationError(e string) {
+	r.err = errors.New(e)
+	r.conn.Close()
+}
+
+func (r *roomCloser) OnJoined(lobby string, players []string) {
+	r.conn.Send("PRIVMSG", lobby, "!mp close")
+}
+
+func (r *roomCloser) OnJoinError(e string) {
+	r.missing = true
+	r.conn.Close()
+}
+
+func (r *roomCloser) OnClosed(lobby string) {
+	r.closed = true
+	r.conn.Close()
+}
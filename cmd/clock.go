@@ -0,0 +1,87 @@
+package main
+
+import (
+	"sync"
+	"time"
+	"slices"
+)
+
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type virtualClock struct {
+	mu sync.Mutex
+	now time.Time
+	timers []*virtualTimer
+}
+
+type virtualTimer struct {
+	c *virtualClock
+	at time.Time
+	f func()
+}
+
+func (c *virtualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *virtualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &virtualTimer{ c: c, at: c.now.Add(d), f: f }
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (c *virtualClock) Advance(to time.Time) {
+	for {
+		c.mu.Lock()
+		i := -1
+		for j, t := range c.timers {
+			if !t.at.After(to) && (i == -1 || t.at.Before(c.timers[i].at)) {
+				i = j
+			}
+		}
+		if i == -1 {
+			if to.After(c.now) {
+				c.now = to
+			}
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[i]
+		c.timers = slices.Delete(c.timers, i, i+1)
+		c.now = t.at
+		c.mu.Unlock()
+		t.f()
+	}
+}
+
+func (t *virtualTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	i := slices.Index(t.c.timers, t)
+	if i == -1 {
+		return false
+	}
+	t.c.timers = slices.Delete(t.c.timers, i, i+1)
+	return true
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"time"
+	"bufio"
+	"strings"
+
+	"golang.org/x/term"
+	"github.com/google/shlex"
+)
+
+type Console struct {
+	term *term.Terminal
+	state *term.State
+	scanner *bufio.Scanner
+}
+
+var stdout io.Writer = os.Stdout
+
+func NewConsole() (*Console, error) {
+	c := &Console{}
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		c.scanner = bufio.NewScanner(os.Stdin)
+		return c, nil
+	}
+
+	var e error
+	if c.state, e = term.MakeRaw(fd); e != nil {
+		return nil, e
+	}
+	c.term = term.NewTerminal(struct{ io.Reader; io.Writer }{ os.Stdin, os.Stdout }, "> ")
+	return c, nil
+}
+
+func (c *Console) Write(p []byte) (int, error) {
+	if c.term != nil {
+		return c.term.Write(p)
+	}
+	return os.Stdout.Write(p)
+}
+
+func (c *Console) SetPrompt(prompt string) {
+	if c.term != nil {
+		c.term.SetPrompt(prompt)
+		c.term.Write(nil)
+	}
+}
+
+func (c *Console) ReadLine(prompt string) (string, error) {
+	if c.term != nil {
+		c.term.SetPrompt(prompt)
+		return c.term.ReadLine()
+	}
+	if !c.scanner.Scan() {
+		if e := c.scanner.Err(); e != nil {
+			return "", e
+		}
+		return "", io.EOF
+	}
+	return c.scanner.Text(), nil
+}
+
+func (c *Console) Close() error {
+	if c.state != nil {
+		return term.Restore(int(os.Stdin.Fd()), c.state)
+	}
+	return nil
+}
+
+func (b *Bot) runConsole(c *Console, quitCh chan<- bool) {
+	defer ReportPanic(b)
+
+	stopCh, doneCh := make(chan struct{}), make(chan struct{})
+	go func(){
+		defer close(doneCh)
+		t := time.NewTicker(time.Second)
+		defer t.Stop()
+		prompt := ""
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-t.C:
+				if p := b.prompt(); p != prompt {
+					prompt = p
+					c.SetPrompt(p)
+				}
+			}
+		}
+	}()
+
+	for {
+		l, e := c.ReadLine(b.prompt())
+		if e == io.EOF && c.term == nil {
+			close(stopCh)
+			return
+		}
+		if e != nil || l == "exit" || l == "quit" {
+			break
+		}
+		args, e := shlex.Split(l)
+		if e != nil {
+			fmt.Fprintln(stdout, e)
+			continue
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		b.mu.Lock()
+		if b.lobby == "" {
+			fmt.Fprintln(stdout, "Not in a lobby yet")
+		} else {
+			b.runCommand(b.config.IRC.User, strings.TrimPrefix(args[0], "!"), args[1:], func(msg ...any){
+				fmt.Fprintln(stdout, msg...)
+			})
+		}
+		b.mu.Unlock()
+	}
+
+	close(stopCh)
+	<-doneCh
+
+	inp, _ := c.ReadLine("Close the lobby? [y/N]: ")
+	quitCh <- inp == "y"
+}
+
+func (b *Bot) prompt() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.lobby == "" {
+		return "> "
+	}
+
+	parts := []string{b.lobby, fmt.Sprintf("%v players", len(b.queue))}
+	if len(b.queue) > 0 {
+		parts = append(parts, "host " + b.queue[0].Name)
+	}
+	if b.beatmap.ID != 0 {
+		parts = append(parts, fmt.Sprintf("%.2f* %v", b.beatmap.Stars, b.beatmap.BeatmapSet.Title))
+	}
+	if b.matchInProgress {
+		parts = append(parts, formatDuration(b.timeLeft()) + " left")
+	}
+	return "[" + strings.Join(parts, " | ") + "] > "
+}
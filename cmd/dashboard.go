@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"sync"
+	"bytes"
+	"strings"
+	"log/slog"
+	"net/http"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+
+	_ "embed"
+
+	"osubot/osu/api"
+)
+
+type State struct {
+	Lobby string           `json:"lobby"`
+	Queue []Player         `json:"queue"`
+	Beatmap *api.Beatmap   `json:"beatmap"`
+	MatchInProgress bool   `json:"matchInProgress"`
+	TimeLeft int           `json:"timeLeft"`
+	Settings StateSettings `json:"settings"`
+}
+
+type StateSettings struct {
+	HostRotation bool          `json:"hostRotation"`
+	PrintQueue bool            `json:"printQueue"`
+	DifficultyConstraint bool  `json:"difficultyConstraint"`
+	DifficultyRange [2]float32 `json:"difficultyRange"`
+}
+
+type CommandRequest struct {
+	Command string `json:"command"`
+	Args []string  `json:"args"`
+}
+
+type CommandResponse struct {
+	Replies []string `json:"replies"`
+}
+
+//go:embed dashboard.html
+var dashboardPage []byte
+
+func (b *Bot) serveHTTP(addr, token string) error {
+	if addr == "" {
+		addr = "127.0.0.1:8080"
+	}
+	if token == "" {
+		t := make([]byte, 16)
+		rand.Read(t)
+		token = hex.EncodeToString(t)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", authorized(token, b.handleDashboard))
+	mux.HandleFunc("GET /api/state", authorized(token, b.handleState))
+	mux.HandleFunc("GET /api/events", authorized(token, b.handleEvents))
+	mux.HandleFunc("POST /api/command", authorized(token, b.handleCommand))
+
+	slog.Info(fmt.Sprintf("Dashboard is available at http://%v/?token=%v", addr, token))
+	return http.ListenAndServe(addr, mux)
+}
+
+func authorized(token string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		t := r.URL.Query().Get("token")
+		if a, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			t = a
+		}
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) != 1 {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (b *Bot) handleDashboard(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(dashboardPage)
+}
+
+func (b *Bot) handleState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b.state())
+}
+
+func (b *Bot) handleEvents(w http.ResponseWriter, r *http.Request) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	t := time.NewTicker(time.Second)
+	defer t.Stop()
+
+	var last []byte
+	for {
+		data, e := json.Marshal(b.state())
+		if e != nil {
+			return
+		}
+		if !bytes.Equal(data, last) {
+			if _, e = fmt.Fprintf(w, "data: %s\n\n", data); e != nil {
+				return
+			}
+			f.Flush()
+			last = data
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (b *Bot) handleCommand(w http.ResponseWriter, r *http.Request) {
+	var rq CommandRequest
+	if e := json.NewDecoder(r.Body).Decode(&rq); e != nil || rq.Command == "" {
+		http.Error(w, "invalid command", http.StatusBadRequest)
+		return
+	}
+
+	b.mu.Lock()
+	if b.lobby == "" {
+		b.mu.Unlock()
+		http.Error(w, "not in a lobby", http.StatusConflict)
+		return
+	}
+	var rpMu sync.Mutex
+	rp := CommandResponse{ Replies: []string{} }
+	b.runCommand(b.config.IRC.User, rq.Command, rq.Args, func(msg ...any){
+		rpMu.Lock()
+		defer rpMu.Unlock()
+		rp.Replies = append(rp.Replies, strings.TrimSuffix(fmt.Sprintln(msg...), "\n"))
+	})
+	b.mu.Unlock()
+
+	rpMu.Lock()
+	defer rpMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rp)
+}
+
+func (b *Bot) state() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := State{
+		Lobby: b.lobby,
+		Queue: append([]Player{}, b.queue...),
+		MatchInProgress: b.matchInProgress,
+		Settings: StateSettings{
+			HostRotation: b.config.HR.Enabled,
+			PrintQueue: b.config.HR.PrintQueue,
+			DifficultyConstraint: b.config.DC.Enabled,
+			DifficultyRange: b.config.DC.Range,
+		},
+	}
+	if b.beatmap.ID != 0 {
+		bm := b.beatmap
+		s.Beatmap = &bm
+	}
+	if b.matchInProgress {
+		s.TimeLeft = max(0, int(b.timeLeft().Seconds()))
+	}
+	return s
+}
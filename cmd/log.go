@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"strings"
+	"log/slog"
+
+	"osubot"
+	"osubot/osu/api"
+	"osubot/osu/irc"
+)
+
+var events = slog.New(slog.DiscardHandler)
+
+func setupLogging(c osubot.Config, w io.Writer) error {
+	var level slog.Level
+	if c.Log.Level != "" {
+		if e := level.UnmarshalText([]byte(c.Log.Level)); e != nil {
+			return e
+		}
+	}
+
+	if c.Log.File != "" {
+		f, e := osubot.OpenRotatingFile(c.Log.File, int64(c.Log.MaxSize) << 20, c.Log.MaxFiles)
+		if e != nil {
+			return e
+		}
+		w = io.MultiWriter(w, f)
+	}
+	w = redactingWriter{ w }
+
+	opts := &slog.HandlerOptions{ Level: level }
+	switch c.Log.Format {
+	case "", "text":
+		slog.SetDefault(slog.New(slog.NewTextHandler(w, opts)))
+	case "json":
+		slog.SetDefault(slog.New(slog.NewJSONHandler(w, opts)))
+	default:
+		return fmt.Errorf("unknown log format %q", c.Log.Format)
+	}
+
+	if c.Log.Events != "" {
+		f, e := os.OpenFile(c.Log.Events, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644)
+		if e != nil {
+			return e
+		}
+		events = slog.New(slog.NewJSONHandler(redactingWriter{ f }, nil))
+	}
+	return nil
+}
+
+func logEvent(msg, lobby, user string, args ...any) {
+	args = append([]any{"lobby", lobby, "user", user}, args...)
+	slog.Debug(msg, args...)
+	events.Info(msg, args...)
+}
+
+func logRejection(msg, lobby, user string, args ...any) {
+	args = append([]any{"lobby", lobby, "user", user}, args...)
+	slog.Info(msg, args...)
+	events.Warn(msg, args...)
+}
+
+func (b *Bot) mp(target string, args ...any) {
+	logEvent("!mp", target, "", "args", strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+	b.conn.Send("PRIVMSG", append([]any{target, "!mp"}, args...)...)
+}
+
+func formatBeatmap(bm api.Beatmap) string {
+	if bm.BeatmapSet == nil {
+		return fmt.Sprintf("%v [%v]", bm.ID, bm.Name)
+	}
+	return fmt.Sprintf("%v - %v [%v]", bm.BeatmapSet.Artist, bm.BeatmapSet.Title, bm.Name)
+}
+
+func logEvents(next irc.Handler) irc.Handler {
+	return func(e irc.Event) {
+		if e.Name != "user command" && e.Name != "private command" {
+			logEvent(e.Name, e.Lobby, e.User, e.Attrs...)
+		}
+		next(e)
+	}
+}
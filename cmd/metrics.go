@@ -0,0 +1,18 @@
+package main
+
+import (
+	"osubot/metrics"
+)
+
+var (
+	matchesPlayed = metrics.NewCounter("osubot_matches_played_total", "Matches played to the end.")
+	mapsRejected = metrics.NewCounterVec("osubot_maps_rejected_total", "Beatmaps rejected by the bot.", "rule")
+	playersJoined = metrics.NewCounter("osubot_players_joined_total", "Players that joined the room.")
+	playersLeft = metrics.NewCounter("osubot_players_left_total", "Players that left the room.")
+	moderationActions = metrics.NewCounterVec(
+		"osubot_moderation_actions_total",
+		"Warnings, kicks and bans issued by the chat moderation.",
+		"action",
+	)
+	reconnects = metrics.NewCounter("osubot_reconnects_total", "Times the bot reconnected to the IRC server after losing the connection.")
+)
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"regexp"
+	"strings"
+	"log/slog"
+
+	"osubot"
+	"osubot/osu/irc"
+)
+
+type Moderator struct {
+	irc.BaseDispatcher
+	b *Bot
+	blocklist []*regexp.Regexp
+	recent map[string][]time.Time
+	last map[string]string
+	repeats map[string]int
+	strikes map[string][]time.Time
+}
+
+var linkRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+`)
+
+func NewModerator(b *Bot, c osubot.Config) (*Moderator, error) {
+	m := &Moderator{
+		b: b,
+		recent: map[string][]time.Time{},
+		last: map[string]string{},
+		repeats: map[string]int{},
+		strikes: map[string][]time.Time{},
+	}
+	if e := m.configure(c); e != nil {
+		return nil, e
+	}
+	return m, nil
+}
+
+func (m *Moderator) configure(c osubot.Config) error {
+	var blocklist []*regexp.Regexp
+	for _, w := range c.Moderation.Blocklist {
+		expr := `(?i)\b` + regexp.QuoteMeta(w) + `\b`
+		if len(w) > 2 && strings.HasPrefix(w, "/") && strings.HasSuffix(w, "/") {
+			expr = w[1:len(w)-1]
+		}
+		re, e := regexp.Compile(expr)
+		if e != nil {
+			return fmt.Errorf("moderation.blocklist: %w", e)
+		}
+		blocklist = append(blocklist, re)
+	}
+	m.blocklist = blocklist
+	return nil
+}
+
+func (m *Moderator) OnUserMessage(lobby, user, message string) {
+	m.check(lobby, user, message)
+}
+
+func (m *Moderator) OnUserAction(lobby, user, action string) {
+	m.check(lobby, user, action)
+}
+
+func (m *Moderator) OnUserLeft(lobby, user string) {
+	b := m.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(m.recent, user)
+	delete(m.last, user)
+	delete(m.repeats, user)
+	for name := range m.strikes {
+		if m.activeStrikes(name, b.clock.Now()) == 0 {
+			delete(m.strikes, name)
+		}
+	}
+}
+
+func (m *Moderator) activeStrikes(user string, now time.Time) int {
+	minutes := m.b.config.Moderation.StrikeMinutes
+	if minutes == 0 {
+		minutes = 60
+	}
+	cutoff := now.Add(-time.Duration(minutes) * time.Minute)
+	strikes := m.strikes[user]
+	for len(strikes) > 0 && !strikes[0].After(cutoff) {
+		strikes = strikes[1:]
+	}
+	m.strikes[user] = strikes
+	return len(strikes)
+}
+
+func (m *Moderator) OnUserJoined(lobby, user string) {
+	b := m.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	until, ok := b.cache.Bans[user]
+	if !ok {
+		return
+	}
+	if !b.clock.Now().Before(until) {
+		delete(b.cache.Bans, user)
+		b.saveCache()
+		return
+	}
+	logRejection("moderation", lobby, user, "action", "ban", "until", until)
+	moderationActions.With("ban").Inc()
+	b.conn.Send(
+		"PRIVMSG",
+		lobby,
+		fmt.Sprintf("%v is banned from this room for %v", user, formatDuration(until.Sub(b.clock.Now()))),
+	)
+	b.mp(lobby, "kick", user)
+}
+
+func (m *Moderator) check(lobby, user, message string) {
+	b := m.b
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.config.Moderation
+	if !c.Enabled || lobby != b.lobby || user == b.config.IRC.User {
+		return
+	}
+
+	now := b.clock.Now()
+	rule := ""
+
+	if c.FloodMessages > 0 && c.FloodSeconds > 0 {
+		window := now.Add(-time.Duration(c.FloodSeconds) * time.Second)
+		recent := m.recent[user]
+		for len(recent) > 0 && recent[0].Before(window) {
+			recent = recent[1:]
+		}
+		recent = append(recent, now)
+		m.recent[user] = recent
+		if len(recent) > c.FloodMessages {
+			rule = "flood"
+			m.recent[user] = nil
+		}
+	}
+
+	normalized := strings.ToLower(strings.TrimSpace(message))
+	if m.last[user] == normalized {
+		m.repeats[user]++
+	} else {
+		m.last[user], m.repeats[user] = normalized, 1
+	}
+	if rule == "" && c.Repeats > 0 && m.repeats[user] >= c.Repeats {
+		rule = "repeat"
+		m.repeats[user] = 0
+	}
+
+	if rule == "" && c.BlockLinks && linkRe.MatchString(message) {
+		rule = "link"
+	}
+
+	if rule == "" {
+		for _, re := range m.blocklist {
+			if re.MatchString(message) {
+				rule = "blocklist"
+				break
+			}
+		}
+	}
+
+	if rule == "" {
+		return
+	}
+
+	m.activeStrikes(user, now)
+	m.strikes[user] = append(m.strikes[user], now)
+	switch len(m.strikes[user]) {
+	case 1:
+		logRejection("moderation", lobby, user, "action", "warn", "rule", rule, "text", message)
+		moderationActions.With("warn").Inc()
+		b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("%v, please don't %v, next time you will be kicked.", user, ruleDescription(rule)))
+	case 2:
+		logRejection("moderation", lobby, user, "action", "kick", "rule", rule, "text", message)
+		moderationActions.With("kick").Inc()
+		b.mp(lobby, "kick", user)
+	default:
+		until := now.Add(time.Duration(max(c.BanMinutes, 1)) * time.Minute)
+		logRejection("moderation", lobby, user, "action", "ban", "rule", rule, "text", message, "until", until)
+		moderationActions.With("ban").Inc()
+		if b.cache.Bans == nil {
+			b.cache.Bans = map[string]time.Time{}
+		}
+		b.cache.Bans[user] = until
+		b.saveCache()
+		delete(m.strikes, user)
+		slog.Info("Banned", "user", user, "until", until)
+		b.mp(lobby, "kick", user)
+	}
+}
+
+func ruleDescription(rule string) string {
+	switch rule {
+	case "flood":
+		return "flood the chat"
+	case "repeat":
+		return "repeat the same message"
+	case "link":
+		return "post links"
+	default:
+		return "use that kind of language"
+	}
+}
@@ -3,28 +3,41 @@ package main
 import (
 	"os"
 	"fmt"
+	"net"
 	"time"
+	"errors"
 	"sync"
 	"slices"
 	"context"
 	"strings"
 	"strconv"
+	"log/slog"
+	"syscall"
 	"os/signal"
 	"runtime/debug"
 
 	"osubot"
 	"osubot/osu/api"
 	"osubot/osu/irc"
+	"osubot/metrics"
+	"osubot/recording"
+
+	"golang.org/x/term"
 )
 
 type Player struct {
-	Name string
-	AutoSkip bool
+	Name string    `json:"name"`
+	AutoSkip bool  `json:"autoSkip"`
 }
 
 type Bot struct {
+	irc.BaseDispatcher
 	mu sync.Mutex
+	clock Clock
+	cachePath string
+	configPath string
 	config osubot.Config
+	fileConfig osubot.Config
 	cache osubot.Cache
 	conn irc.Conn
 	api *api.Client
@@ -34,78 +47,112 @@ type Bot struct {
 	matchInProgress bool
 	matchStartTime time.Time
 	mustDefineQueue bool
+	referee *Referee
+	syncCount int
+	syncSlots []string
+	syncHost string
+	crashPath string
+	logLevel string
+	passphrase string
+	panics int
+	rec *recording.Recorder
+	everAuthenticated bool
+	quitting bool
+	bus *irc.Bus
+	notifier *Notifier
+	queueState queueState
+	requests []Request
+	searchResults []api.Beatmap
+	requestServed map[string]time.Time
+	skills map[string]Skill
+	moderator *Moderator
+	fatal error
+	pending sync.WaitGroup
 }
 
 func (b *Bot) OnAuthenticated() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	b.everAuthenticated = true
+
 	if b.cache.Lobby != "" {
-		fmt.Println("Attempting to rejoin", b.cache.Lobby)
+		slog.Info("Attempting to rejoin", "lobby", b.cache.Lobby)
 		b.conn.Send("JOIN", b.cache.Lobby)
 	} else {
-		fmt.Println("Creating new lobby")
-		b.conn.Send("PRIVMSG", "BanchoBot", "!mp", "make", b.config.IRC.User + "'s game")
+		b.makeRoom()
 	}
 }
 
 func (b *Bot) OnAuthenticationError(e string) {
-	panic(e)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	slog.Error("Failed to authenticate", "error", e)
+	b.fatal = fmt.Errorf("authentication failed: %v", e)
+	b.conn.Close()
 }
 
 func (b *Bot) OnJoined(lobby string, players []string) {
-	fmt.Println("Joined lobby", lobby)
+	slog.Info("Joined lobby", "lobby", lobby)
 
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	if b.lobby == lobby {
+		slog.Info("Reconnected to the lobby, synchronizing the room state", "lobby", lobby)
+		b.notifier.Notify("reconnect", lobby, "", nil)
+		b.mp(lobby, "settings")
+		return
+	}
+
 	b.lobby = lobby
 
 	b.queue = make([]Player, len(players), len(players))
 	for i, name := range players {
 		b.queue[i] = Player{ Name: name }
 	}
+	b.resetQueueState(b.queue)
+	b.requests = nil
+	b.skills = nil
+	for _, name := range players {
+		b.fetchSkill(lobby, name)
+	}
 
 	if b.cache.Lobby != lobby {
-		b.conn.Send("PRIVMSG", lobby, "!mp", "password")
-		b.conn.Send("PRIVMSG", lobby, "!mp", "mods", "Freemod")
-		b.conn.Send("PRIVMSG", lobby, "!mp", "size", "8")
-		b.conn.Send("PRIVMSG", lobby, "!mp", "invite", b.config.IRC.User)
+		b.notifier.Notify("room_created", lobby, "", nil)
+		b.setupRoom(lobby)
 	} else if len(players) > 1 {
 		b.mustDefineQueue = true
 		b.config.HR.Enabled = false
-		fmt.Println("HR is disabled because the bot does not know what the host queue order was")
+		slog.Warn("HR is disabled because the bot does not know what the host queue order was")
 	}
 
 	b.cache.Lobby = lobby
-	b.cache.SaveFile(cachePath)
+	b.saveCache()
 }
 
 func (b *Bot) OnJoinError(e string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	fmt.Println(e)
+	slog.Error("Failed to join the lobby", "error", e)
 
 	if b.cache.Lobby != "" {
 		b.cache.Lobby = ""
-		b.cache.SaveFile(cachePath)
-		fmt.Println("Creating new lobby")
-		b.conn.Send("PRIVMSG", "BanchoBot", "!mp", "make", b.config.IRC.User + "'s game")
+		b.saveCache()
+		b.makeRoom()
 	} else {
 		b.conn.Close()
 	}
 }
 
-func (b *Bot) OnLeft(lobby string) {
-}
-
 func (b *Bot) OnClosed(lobby string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
 	b.cache.Lobby = ""
-	b.cache.SaveFile(cachePath)
+	b.saveCache()
 	b.conn.Close()
 }
 
@@ -113,10 +160,12 @@ func (b *Bot) OnUserJoined(lobby, user string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.queue = append(b.queue, Player{ Name: user })
+	playersJoined.Inc()
+	b.addToQueue(user)
+	b.fetchSkill(lobby, user)
 
 	if len(b.queue) == 1 {
-		b.conn.Send("PRIVMSG", lobby, "!mp", "host", user)
+		b.mp(lobby, "host", user)
 	}
 }
 
@@ -124,20 +173,24 @@ func (b *Bot) OnUserLeft(lobby, user string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	i := slices.IndexFunc(b.queue, playerIndexFunc(user))
-	b.queue = slices.Concat(b.queue[:i], b.queue[i+1:])
+	playersLeft.Inc()
+	if len(b.queue) > 0 && b.queue[0].Name == user {
+		b.queueState.hosted[user] = b.clock.Now()
+	}
+	i := b.removeFromQueue(user)
+	b.forgetSkill(lobby, user)
 
 	if len(b.queue) == 0 {
-		fmt.Println("All players have left, closing the lobby")
-		b.conn.Send("PRIVMSG", lobby, "!mp", "close")
+		slog.Info("All players have left, closing the lobby", "lobby", lobby)
+		b.mp(lobby, "close")
 	} else if b.config.HR.Enabled && i == 0 {
-		fmt.Printf("The host has left, transferring host to the next player (%v)\n", b.queue[0].Name)
-		b.conn.Send("PRIVMSG", lobby, "!mp", "host", b.queue[0].Name)
+		slog.Info("The host has left, transferring host to the next player", "lobby", lobby, "user", b.queue[0].Name)
+		b.mp(lobby, "host", b.queue[0].Name)
 	}
 
 	if len(b.queue) <= 1 && b.mustDefineQueue {
 		b.mustDefineQueue = false
-		fmt.Println("HR queue can now be enabled")
+		slog.Info("HR queue can now be enabled")
 	}
 }
 
@@ -145,9 +198,9 @@ func (b *Bot) OnHostChanged(lobby, user string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if user != b.queue[0].Name && b.config.HR.Enabled && !b.mustDefineQueue {
-		fmt.Println("Reverting illegal host transfer to", user)
-		b.conn.Send("PRIVMSG", lobby, "!mp", "host", b.queue[0].Name)
+	if len(b.queue) > 0 && user != b.queue[0].Name && b.config.HR.Enabled && !b.mustDefineQueue {
+		logRejection("Reverting illegal host transfer", lobby, user)
+		b.mp(lobby, "host", b.queue[0].Name)
 		b.conn.Send(
 			"PRIVMSG",
 			lobby,
@@ -161,7 +214,7 @@ func (b *Bot) OnHostChanged(lobby, user string) {
 		return
 	}
 
-	fmt.Println(user, "became the host")
+	slog.Info("Host changed", "lobby", lobby, "user", user)
 }
 
 func (b *Bot) OnBeatmapChanged(lobby, artist, title, difficulty string, id int) {
@@ -172,22 +225,33 @@ func (b *Bot) OnBeatmapChanged(lobby, artist, title, difficulty string, id int)
 	defer cancel()
 	bm, e := b.api.GetBeatmap(ctx, id)
 	if e != nil {
-		fmt.Println("Failed to fetch beatmap info:", e)
+		slog.Error("Failed to fetch beatmap info", "id", id, "error", e)
+		b.notifier.MapPicked(lobby, fmt.Sprintf("%v - %v [%v]", artist, title, difficulty), id)
 		return
 	}
 
 	if b.config.DC.Enabled {
 		if bm.Stars < b.config.DC.Range[0] || bm.Stars > b.config.DC.Range[1] {
 			if b.beatmap.ID != 0 {
-				fmt.Printf(
-					"Rejecting %v - %v [%v] %.2f*\n",
-					bm.BeatmapSet.Artist,
-					bm.BeatmapSet.Title,
-					bm.Name,
-					bm.Stars,
+				var host string
+				if len(b.queue) > 0 {
+					host = b.queue[0].Name
+				}
+				logRejection(
+					"Rejecting beatmap",
+					lobby,
+					host,
+					"beatmap", formatBeatmap(bm),
+					"stars", bm.Stars,
+					"range", b.config.DC.Range,
 				)
 
-				b.conn.Send("PRIVMSG", lobby, "!mp", "map", b.beatmap.ID, "0")
+				mapsRejected.With("difficulty").Inc()
+				b.mp(lobby, "map", b.beatmap.ID, "0")
+
+				if host == "" {
+					return
+				}
 
 				var mapStatus string
 				if bm.Stars < b.config.DC.Range[0] {
@@ -201,7 +265,7 @@ func (b *Bot) OnBeatmapChanged(lobby, artist, title, difficulty string, id int)
 					fmt.Sprintf(
 						"%v, [https://osu.ppy.sh/beatmapsets/%v#osu/%v %v - %v [%v]] is %v. " +
 						"You can ask %v to change the allowed difficulty range.",
-						b.queue[0].Name,
+						host,
 						bm.BeatmapSetID,
 						bm.ID,
 						bm.BeatmapSet.Artist,
@@ -212,23 +276,25 @@ func (b *Bot) OnBeatmapChanged(lobby, artist, title, difficulty string, id int)
 					),
 				)
 			} else {
-				fmt.Printf(
-					"%v - %v [%v] %.2f* should be rejected but there's no map to fallback to\n",
-					bm.BeatmapSet.Artist,
-					bm.BeatmapSet.Title,
-					bm.Name,
-					bm.Stars,
+				slog.Warn(
+					"Beatmap should be rejected but there's no map to fallback to",
+					"lobby", lobby,
+					"beatmap", formatBeatmap(bm),
+					"stars", bm.Stars,
 				)
 			}
 			return
 		}
 	}
 
+	if bm.ID != b.beatmap.ID {
+		b.notifier.MapPicked(lobby, fmt.Sprintf("%v - %v [%v]", artist, title, difficulty), id)
+	}
 	b.beatmap = bm
 }
 
 func (b *Bot) OnAllPlayersReady(lobby string) {
-	b.conn.Send("PRIVMSG", lobby, "!mp", "start")
+	b.mp(lobby, "start")
 }
 
 func (b *Bot) OnMatchStarted(lobby string) {
@@ -236,7 +302,23 @@ func (b *Bot) OnMatchStarted(lobby string) {
 	defer b.mu.Unlock()
 
 	b.matchInProgress = true
-	b.matchStartTime = time.Now()
+	b.matchStartTime = b.clock.Now()
+
+	if b.referee != nil {
+		b.referee.scores = [2]int{}
+	}
+}
+
+func (b *Bot) OnPlayerFinished(lobby, user string, score int, passed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.referee == nil {
+		return
+	}
+	if t := b.referee.teamOf(user); t != -1 {
+		b.referee.scores[t] += score
+	}
 }
 
 func (b *Bot) OnMatchFinished(lobby string) {
@@ -244,11 +326,19 @@ func (b *Bot) OnMatchFinished(lobby string) {
 	defer b.mu.Unlock()
 
 	b.matchInProgress = false
+	matchesPlayed.Inc()
 
-	if b.config.HR.Enabled && !b.mustDefineQueue {
-		b.rotateHost(lobby)
-		if b.config.HR.PrintQueue {
-			b.printQueue(lobby)
+	if b.referee != nil {
+		b.onTournamentMatchFinished(lobby)
+	} else {
+		if b.config.HR.Enabled && !b.mustDefineQueue {
+			b.rotateHost(lobby)
+			if b.config.HR.PrintQueue {
+				b.printQueue(lobby)
+			}
+		}
+		if b.config.Requests.Enabled {
+			b.playNextRequest(lobby)
 		}
 	}
 }
@@ -260,21 +350,62 @@ func (b *Bot) OnMatchAborted(lobby string) {
 	b.matchInProgress = false
 }
 
-func (b *Bot) OnUserMessage(lobby, user, message string) {
+func (b *Bot) OnUserCommand(lobby, user, cmd string, args []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	target := lobby
+	if slices.Contains(b.config.Commands.Private, cmd) {
+		target = user
+	}
+	b.runCommand(user, cmd, args, func(msg ...any){
+		b.conn.Send("PRIVMSG", append([]any{target}, msg...)...)
+	})
 }
 
-func (b *Bot) OnUserCommand(lobby, user, cmd string, args []string) {
+func (b *Bot) OnPrivateCommand(user, cmd string, args []string) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if cmd == "q" || cmd == "queue" {
-		if len(args) > 0 && user == b.config.IRC.User {
+	reply := func(msg ...any){
+		b.conn.Send("PRIVMSG", append([]any{user}, msg...)...)
+	}
+	if b.lobby == "" {
+		reply("Not in a lobby")
+		return
+	}
+	if slices.Contains(playerCommands, cmd) && user != b.config.IRC.User && !slices.ContainsFunc(b.queue, playerIndexFunc(user)) {
+		reply(fmt.Sprintf("Only players in the room can use !%v", cmd))
+		return
+	}
+	b.runCommand(user, cmd, args, reply)
+}
+
+var playerCommands = []string{ "request", "r", "search", "recommend", "pb" }
+
+func (b *Bot) runCommand(user, cmd string, args []string, reply func(msg ...any)) {
+	lobby := b.lobby
+	logEvent("command", lobby, user, "command", cmd, "args", args)
+	defer b.recoverCommand(fmt.Sprintf("%v: !%v %v", user, cmd, strings.Join(args, " ")))
+
+	if (cmd == "q" || cmd == "queue") && len(args) > 0 && slices.Contains(queueSubcommands, args[0]) {
+		b.onQueueCommand(lobby, user, args, reply)
+	} else if cmd == "request" || cmd == "r" {
+		b.onRequestCommand(lobby, user, args, reply)
+	} else if cmd == "requests" {
+		b.onRequestsCommand(lobby, user, args, reply)
+	} else if cmd == "leavequeue" {
+		b.leaveQueue(lobby, user, reply)
+	} else if cmd == "joinqueue" {
+		b.joinQueue(user, reply)
+	} else if cmd == "q" || cmd == "queue" {
+		if len(args) > 0 && user == b.config.IRC.User && len(b.queue) > 0 {
 			newQueue := make([]Player, 0, len(b.queue))
 			playersLeft := slices.Clone(b.queue)
 			for _, nameApprox := range args {
 				i := findOnePlayerByApprox(nameApprox, playersLeft)
 				if i == -1 {
-					fmt.Printf("No single player matches \"%v\" approximation.\n", nameApprox)
+					slog.Warn("No single player matches the approximation", "name", nameApprox)
 					continue
 				}
 				newQueue = append(newQueue, playersLeft[i])
@@ -282,110 +413,173 @@ func (b *Bot) OnUserCommand(lobby, user, cmd string, args []string) {
 			}
 			newQueue = slices.Concat(newQueue, playersLeft)
 			if newQueue[0].Name != b.queue[0].Name {
-				b.conn.Send("PRIVMSG", lobby, "!mp", "host", newQueue[0].Name)
+				b.mp(lobby, "host", newQueue[0].Name)
 			}
 			b.queue = newQueue
+			b.keepQueueOrder()
 			b.mustDefineQueue = false
 		}
-		b.printQueue(lobby)
-	} else if (cmd == "s" || cmd == "skip") && (user == b.queue[0].Name || user == b.config.IRC.User) {
+		reply("Queue:", formatQueue(b.queue))
+	} else if (cmd == "s" || cmd == "skip") && len(b.queue) > 0 && (user == b.queue[0].Name || user == b.config.IRC.User) {
 		b.rotateHost(lobby)
 	} else if (cmd == "tl" || cmd == "timeleft") && b.matchInProgress && b.beatmap.ID != 0 {
-		tl := b.matchStartTime.Add(time.Duration(b.beatmap.Length) * time.Second).Sub(time.Now())
-		b.conn.Send(
-			"PRIVMSG",
-			lobby,
-			fmt.Sprintf("Time left: %vm %vs", int(tl.Minutes()), int(tl.Seconds()) % 60),
-		)
+		reply("Time left:", formatDuration(b.timeLeft()))
 	} else if cmd == "hr" && user == b.config.IRC.User {
 		if len(args) == 0 {
 			if b.mustDefineQueue {
-				b.conn.Send("PRIVMSG", lobby, "Host rotation is disabled until the queue is defined")
+				reply("Host rotation is disabled until the queue is defined")
 			} else {
-				b.conn.Send(
-					"PRIVMSG",
-					lobby,
-					"Host rotation is " + boolToEnabledDisabled(b.config.HR.Enabled),
-				)
+				reply("Host rotation is " + boolToEnabledDisabled(b.config.HR.Enabled))
 			}
 		} else if len(args) == 1 && (args[0] == "on" || args[0] == "off") {
 			if args[0] == "on" {
 				if b.mustDefineQueue {
-					fmt.Println("Attempted to enable HR without defining the queue")
-					b.conn.Send("PRIVMSG", lobby, "Define the queue first using !q command")
+					slog.Warn("Attempted to enable HR without defining the queue")
+					reply("Define the queue first using !q command")
 					return
 				}
 				b.config.HR.Enabled = true
 			} else {
 				b.config.HR.Enabled = false
 			}
-			fmt.Println("HR", boolToEnabledDisabled(b.config.HR.Enabled))
+			b.config.Overrides.HostRotation = ptr(b.config.HR.Enabled)
+			b.saveOverrides()
+			slog.Info("HR " + boolToEnabledDisabled(b.config.HR.Enabled))
 		} else {
-			b.conn.Send("PRIVMSG", lobby, "Syntax: !HR [on/off]")
+			reply("Syntax: !HR [on/off]")
 		}
 	} else if cmd == "dc" && user == b.config.IRC.User {
 		if len(args) == 0 {
-			b.conn.Send(
-				"PRIVMSG",
-				lobby,
-				"Difficulty constraint is " + boolToEnabledDisabled(b.config.DC.Enabled),
-			)
+			reply("Difficulty constraint is " + boolToEnabledDisabled(b.config.DC.Enabled))
 		} else if len(args) == 1 && (args[0] == "on" || args[0] == "off") {
 			if args[0] == "on" {
 				b.config.DC.Enabled = true
 			} else {
 				b.config.DC.Enabled = false
 			}
-			fmt.Println("DC", boolToEnabledDisabled(b.config.DC.Enabled))
+			b.config.Overrides.DifficultyConstraint = ptr(b.config.DC.Enabled)
+			b.saveOverrides()
+			slog.Info("DC " + boolToEnabledDisabled(b.config.DC.Enabled))
 		} else {
-			b.conn.Send("PRIVMSG", lobby, "Syntax: !dc [on/off]")
+			reply("Syntax: !dc [on/off]")
 		}
 	} else if cmd == "dcr" && user == b.config.IRC.User {
 		if len(args) == 0 {
-			b.conn.Send(
-				"PRIVMSG",
-				lobby,
-				fmt.Sprintf("Difficulty range is %v-%v*", b.config.DC.Range[0], b.config.DC.Range[1]),
-			)
+			reply(fmt.Sprintf("Difficulty range is %v-%v*", b.config.DC.Range[0], b.config.DC.Range[1]))
 		} else if len(args) == 2 {
 			rmin, e1 := strconv.ParseFloat(args[0], 32)
 			rmax, e2 := strconv.ParseFloat(args[1], 32)
-			if e1 == nil && e2 == nil {
+			if e1 == nil && e2 == nil && 0 <= rmin && rmin <= rmax {
 				b.config.DC.Range[0], b.config.DC.Range[1] = float32(rmin), float32(rmax)
-				fmt.Printf("Set DCR to %v-%v\n", b.config.DC.Range[0], b.config.DC.Range[1])
+				b.config.Overrides.DifficultyRange = ptr(b.config.DC.Range)
+				b.saveOverrides()
+				slog.Info("Set DCR", "range", b.config.DC.Range)
 			} else {
-				b.conn.Send("PRIVMSG", lobby, "Syntax: !dcr [min max]")
+				reply("Syntax: !dcr [min max]")
 			}
 		} else {
-			b.conn.Send("PRIVMSG", lobby, "Syntax: !dcr [min max]")
+			reply("Syntax: !dcr [min max]")
 		}
 	} else if cmd == "pq" && user == b.config.IRC.User {
 		if len(args) == 0 {
-			b.conn.Send(
-				"PRIVMSG",
-				lobby,
-				fmt.Sprintf("Print queue %v", boolToEnabledDisabled(b.config.HR.PrintQueue)),
-			)
+			reply(fmt.Sprintf("Print queue %v", boolToEnabledDisabled(b.config.HR.PrintQueue)))
 		} else if len(args) == 1 && (args[0] == "on" || args[0] == "off") {
 			if args[0] == "on" {
 				b.config.HR.PrintQueue = true
 			} else {
 				b.config.HR.PrintQueue = false
 			}
-			fmt.Println("PQ", boolToEnabledDisabled(b.config.HR.PrintQueue))
+			b.config.Overrides.PrintQueue = ptr(b.config.HR.PrintQueue)
+			b.saveOverrides()
+			slog.Info("PQ " + boolToEnabledDisabled(b.config.HR.PrintQueue))
+		} else {
+			reply("Syntax: !pq on/off")
+		}
+	} else if (cmd == "pick" || cmd == "ban") && b.referee != nil {
+		b.onTournamentCommand(lobby, user, cmd, args)
+	} else if cmd == "pick" {
+		b.onPickCommand(lobby, user, args, reply)
+	} else if cmd == "search" {
+		b.onSearchCommand(lobby, user, args, reply)
+	} else if cmd == "recommend" {
+		b.onRecommendCommand(lobby, user, reply)
+	} else if cmd == "t" && b.referee != nil {
+		if len(args) == 1 && args[0] == "start" && user == b.config.IRC.User {
+			slog.Info("Starting the tournament")
+			b.startTournament(lobby)
 		} else {
-			b.conn.Send("PRIVMSG", lobby, "Syntax: !pq on/off")
+			reply(b.tournamentStatus())
+		}
+	} else if cmd == "reset" && user == b.config.IRC.User {
+		b.resetSettings()
+		reply(
+			fmt.Sprintf(
+				"Settings were reset: host rotation is %v, difficulty constraint is %v (%v-%v*), print queue is %v",
+				boolToEnabledDisabled(b.config.HR.Enabled),
+				boolToEnabledDisabled(b.config.DC.Enabled),
+				b.config.DC.Range[0],
+				b.config.DC.Range[1],
+				boolToEnabledDisabled(b.config.HR.PrintQueue),
+			),
+		)
+	} else if cmd == "room" && user == b.config.IRC.User {
+		b.onRoomCommand(lobby, args, reply)
+	} else if cmd == "kick" && user == b.config.IRC.User {
+		if len(args) != 1 {
+			reply("Syntax: !kick name")
+			return
+		}
+		i := findOnePlayerByApprox(args[0], b.queue)
+		if i == -1 {
+			reply(fmt.Sprintf("No single player matches \"%v\" approximation.", args[0]))
+			return
+		}
+		slog.Info("Kicking", "user", b.queue[i].Name)
+		b.mp(lobby, "kick", b.queue[i].Name)
+	} else if cmd == "say" && user == b.config.IRC.User {
+		if len(args) == 0 {
+			reply("Syntax: !say message")
+			return
+		}
+		b.conn.Send("PRIVMSG", lobby, strings.Join(args, " "))
+	} else if cmd == "status" {
+		if b.lobby == "" {
+			reply("Not in a lobby")
+			return
+		}
+		reply(fmt.Sprintf("Lobby %v, %v players", b.lobby, len(b.queue)))
+		reply("Queue:", formatQueue(b.queue))
+		if b.beatmap.ID != 0 {
+			reply(
+				fmt.Sprintf(
+					"Beatmap: %v - %v [%v] %.2f*",
+					b.beatmap.BeatmapSet.Artist,
+					b.beatmap.BeatmapSet.Title,
+					b.beatmap.Name,
+					b.beatmap.Stars,
+				),
+			)
+		}
+		if b.matchInProgress {
+			reply("Match in progress, time left:", formatDuration(b.timeLeft()))
 		}
+		reply(
+			fmt.Sprintf(
+				"Host rotation is %v, difficulty constraint is %v (%v-%v*)",
+				boolToEnabledDisabled(b.config.HR.Enabled),
+				boolToEnabledDisabled(b.config.DC.Enabled),
+				b.config.DC.Range[0],
+				b.config.DC.Range[1],
+			),
+		)
 	} else if cmd == "as" || cmd == "autoskip" {
 		i := slices.IndexFunc(b.queue, playerIndexFunc(user))
 		if i == -1 {
-			fmt.Println(user, "is not in the queue!")
+			slog.Warn("The player is not in the queue", "user", user)
 			return
 		}
 		b.queue[i].AutoSkip = !b.queue[i].AutoSkip
-		b.conn.Send(
-			"PRIVMSG",
-			lobby,
+		reply(
 			"Auto skip for",
 			b.queue[i].Name,
 			"is",
@@ -393,12 +587,10 @@ func (b *Bot) OnUserCommand(lobby, user, cmd string, args []string) {
 		)
 	} else if cmd == "m" || cmd == "mirrors" {
 		if b.beatmap.ID == 0 {
-			fmt.Println("The bot couldn't get the beatmap info up to this point")
+			slog.Warn("The bot couldn't get the beatmap info up to this point")
 			return
 		}
-		b.conn.Send(
-			"PRIVMSG",
-			lobby,
+		reply(
 			fmt.Sprintf(
 				"[https://beatconnect.io/b/%[1]v BeatConnect] | " +
 				"[https://nerinyan.moe/d/%[1]v NeriNyan] | " +
@@ -410,27 +602,27 @@ func (b *Bot) OnUserCommand(lobby, user, cmd string, args []string) {
 		if b.beatmap.ID == 0 {
 			return
 		}
-		go func(bm api.Beatmap, bms api.BeatmapSet){
+		bm, bms := b.beatmap, *b.beatmap.BeatmapSet
+		b.async(fmt.Sprintf("%v: !pb", user), func(){
+
 			ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
 			defer cancel()
 
 			u, e := b.api.GetUserByName(ctx, user)
 			if e != nil {
-				fmt.Printf("Failed to get %v's user info: %v\n", user, e)
+				slog.Error("Failed to get user info", "user", user, "error", e)
 				return
 			}
 
 			bs, e := b.api.GetUserScore(ctx, u.ID, bm.ID)
 			if e != nil {
-				fmt.Printf(
-					"Failed to get %v's score on %v - %v [%v]: %v\n",
-					user,
-					bms.Artist,
-					bms.Title,
-					bm.Name,
-					e,
+				slog.Error(
+					"Failed to get user's score",
+					"user", user,
+					"beatmap", fmt.Sprintf("%v - %v [%v]", bms.Artist, bms.Title, bm.Name),
+					"error", e,
 				)
-				b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("Couldn't get %v's best score on this map.", user))
+				reply(fmt.Sprintf("Couldn't get %v's best score on this map.", user))
 			} else {
 				msg := strings.Builder{}
 
@@ -456,21 +648,64 @@ func (b *Bot) OnUserCommand(lobby, user, cmd string, args []string) {
 
 				msg.WriteString(fmt.Sprintf(" %v rank", bs.Score.Rank))
 
-				b.conn.Send("PRIVMSG", lobby, msg.String())
+				reply(msg.String())
 			}
-		}(b.beatmap, *b.beatmap.BeatmapSet)
+		})
 	}
 }
 
+func (b *Bot) handle(m irc.Msg) {
+	defer b.recoverEvent(m.Raw)
+
+	if m.Cmd == "PING" {
+		if t := m.Arg(0); t != "" {
+			b.conn.Send("PONG", t)
+		} else {
+			b.conn.Send("PONG")
+		}
+		return
+	}
+	irc.Dispatch(m, b.bus)
+}
+
+func (b *Bot) newBus() *irc.Bus {
+	bus := irc.NewBus(b)
+	bus.Use(
+		logEvents,
+		irc.Recover(func(e irc.Event, r any){
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			b.reportRecoveredPanic(e.String(), r, debug.Stack())
+		}),
+	)
+	return bus
+}
+
 func (b *Bot) printQueue(lobby string) {
 	b.conn.Send("PRIVMSG", lobby, "Queue:", formatQueue(b.queue))
 }
 
+func (b *Bot) saveCache() {
+	if b.cachePath != "" {
+		b.cache.SaveFile(b.cachePath)
+	}
+}
+
+func (b *Bot) timeLeft() time.Duration {
+	return b.matchStartTime.Add(time.Duration(b.beatmap.Length) * time.Second).Sub(b.clock.Now())
+}
+
 func (b *Bot) rotateHost(lobby string) {
+	if len(b.queue) == 0 {
+		return
+	}
+	b.queueState.hosted[b.queue[0].Name] = b.clock.Now()
+	b.orderQueue()
 	for i := 1; i < len(b.queue); i++ {
 		if !b.queue[i].AutoSkip {
 			b.queue = slices.Concat(b.queue[i:], b.queue[:i])
-			b.conn.Send("PRIVMSG", lobby, "!mp", "host", b.queue[0].Name)
+			b.orderQueue()
+			b.mp(lobby, "host", b.queue[0].Name)
 			return
 		}
 	}
@@ -503,6 +738,64 @@ func formatQueue(queue []Player) string {
 	return "(empty)"
 }
 
+func formatDuration(d time.Duration) string {
+	return fmt.Sprintf("%vm %vs", int(d.Minutes()), int(d.Seconds()) % 60)
+}
+
+func checkConfig(path string) bool {
+	var c osubot.Config
+	if e := c.LoadFile(path); e != nil {
+		fmt.Println(e)
+		return false
+	}
+	if e := c.LoadSecrets(); e != nil {
+		fmt.Println(e)
+		return false
+	}
+	c.LoadEnv()
+	if e := c.Validate(); e != nil {
+		fmt.Printf("%v is invalid:\n%v\n", path, e)
+		return false
+	}
+	if c.Tournament != "" {
+		var t osubot.Tournament
+		if e := t.LoadFile(c.Tournament); e != nil {
+			fmt.Println(e)
+			return false
+		}
+		if e := t.Validate(); e != nil {
+			fmt.Printf("%v is invalid:\n%v\n", c.Tournament, e)
+			return false
+		}
+	}
+	if c.Migrated() {
+		fmt.Printf("%v is valid and will be migrated to version %v when the bot starts\n", path, osubot.ConfigVersion)
+	} else {
+		fmt.Printf("%v is valid\n", path)
+	}
+	return true
+}
+
+func (b *Bot) dialer() irc.Dialer {
+	d := irc.Dialer{
+		TLS: b.config.IRC.TLS,
+		Timeout: time.Duration(b.config.IRC.ConnectTimeout) * time.Second,
+		ReadTimeout: time.Duration(b.config.IRC.ReadTimeout) * time.Second,
+		KeepAlive: time.Duration(b.config.IRC.KeepAlive) * time.Second,
+		Proxy: b.config.IRC.Proxy,
+		PingInterval: time.Duration(b.config.IRC.PingInterval) * time.Second,
+		PingTimeout: time.Duration(b.config.IRC.PingTimeout) * time.Second,
+		Recorder: b.rec,
+	}
+	if d.Timeout == 0 {
+		d.Timeout = 15 * time.Second
+	}
+	if d.PingInterval == 0 {
+		d.PingInterval = time.Minute
+	}
+	return d
+}
+
 func boolToEnabledDisabled(flag bool) string {
 	if flag {
 		return "enabled"
@@ -514,79 +807,221 @@ func playerIndexFunc(targetName string) func(Player)bool {
 	return func(p Player)bool{ return p.Name == targetName }
 }
 
-func main() {
+func run(o options) error {
 	var e error
-	b := &Bot{}
+	b := &Bot{
+		clock: realClock{},
+		configPath: o.configPath,
+		cachePath: o.cachePath,
+		crashPath: o.crashPath,
+		logLevel: o.logLevel,
+	}
+	b.bus = b.newBus()
 
 	defer ReportPanic(b)
 
-	fmt.Println("Loading", configPath)
-	if e = b.config.LoadFile(configPath); e != nil {
-		if os.IsNotExist(e) {
-			fmt.Print("IRC username: ")
-			fmt.Scanln(&b.config.IRC.User)
-			fmt.Print("IRC password: ")
-			fmt.Scanln(&b.config.IRC.Pass)
-			fmt.Print("OAuth Client ID: ")
-			fmt.Scanln(&b.config.API.ID)
-			fmt.Print("OAuth Client Secret: ")
-			fmt.Scanln(&b.config.API.Secret)
-			b.config.IRC.Addr = "irc.ppy.sh:6667"
-			b.config.IRC.RateLimit = 4
-			b.config.API.Addr = "https://osu.ppy.sh"
-			b.config.HR.Enabled = true
-			b.config.DC.Range[1] = 10
-			b.config.SaveFile(configPath)
-		} else {
-			panic(e)
+	slog.Info("Loading " + b.configPath)
+	if e = b.config.LoadFile(b.configPath); e != nil {
+		if !os.IsNotExist(e) {
+			return e
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("%v does not exist, create it with \"osubot init\"", b.configPath)
 		}
+		var user, pass, id, secret string
+		fmt.Print("IRC username: ")
+		fmt.Scanln(&user)
+		pass = readSecret("IRC password: ")
+		fmt.Print("OAuth Client ID: ")
+		fmt.Scanln(&id)
+		secret = readSecret("OAuth Client Secret: ")
+		b.config = osubot.DefaultConfig(user, pass, id, secret)
+		b.config.SaveFile(b.configPath)
+	} else if b.config.Migrated() {
+		slog.Info("Saving migrated " + b.configPath)
+		b.config.SaveFile(b.configPath)
 	}
+	checkPermissions(b.configPath, b.config)
+	if e = b.overrideConfig(&b.config); e != nil {
+		return e
+	}
+	b.fileConfig = b.config
+	b.config = b.config.WithOverrides()
+	if e = b.config.Validate(); e != nil {
+		return fmt.Errorf("invalid %v:\n%w", b.configPath, e)
+	}
+
+	if console, e = NewConsole(); e != nil {
+		return e
+	}
+	defer console.Close()
+	stdout = console
+
+	if e = setupLogging(b.config, console); e != nil {
+		return e
+	}
+
+	if b.config.Tournament != "" {
+		slog.Info("Loading " + b.config.Tournament)
+		var t osubot.Tournament
+		if e = t.LoadFile(b.config.Tournament); e != nil {
+			return e
+		}
+		if e = t.Validate(); e != nil {
+			return fmt.Errorf("invalid %v:\n%w", b.config.Tournament, e)
+		}
+		b.referee = NewReferee(t)
+		b.config.HR.Enabled = false
+		b.config.DC.Enabled = false
+	}
+
+	b.moderator, e = NewModerator(b, b.config)
+	if e != nil {
+		return e
+	}
+	b.bus.Subscribe(b.moderator)
+
+	if b.notifier, e = NewNotifier(b.config.Webhooks); e != nil {
+		return e
+	}
+	b.bus.Subscribe(b.notifier)
 
 	b.api = api.NewClient(b.config.API.Addr, b.config.API.ID, b.config.API.Secret)
 
-	fmt.Println("Loading", cachePath)
-	b.cache.LoadFile(cachePath)
+	slog.Info("Loading " + b.cachePath)
+	b.cache.LoadFile(b.cachePath)
 
-	fmt.Println("Connecting to", b.config.IRC.Addr)
-	b.conn, e = irc.Connect(b.config.IRC.Addr, b.config.IRC.RateLimit)
+	if b.config.Record != "" {
+		if b.rec, e = b.startRecording(b.config.Record); e != nil {
+			return e
+		}
+		b.api.SetTransport(recording.Transport{ Recorder: b.rec })
+	}
 
-	fmt.Println("Authenticating as", b.config.IRC.User)
-	b.conn.Send("PASS", b.config.IRC.Pass)
-	b.conn.Send("NICK", b.config.IRC.User)
+	if e = b.connect(); e != nil {
+		return e
+	}
 
 	errCh := make(chan error)
 	go func(){
 		defer ReportPanic(b)
-
-		var e error
-		var m irc.Msg
-		for m, e = b.conn.Recv(); e == nil; m, e = b.conn.Recv() {
-			if m.Cmd == "PING" {
-				b.conn.Send("PONG")
-				continue
-			}
-			irc.Dispatch(m, b)
-		}
-		errCh <- e
+		errCh <- b.receive()
 		close(errCh)
 	}()
 
-	sigCh := make(chan os.Signal)
+	if b.config.Metrics.Enabled {
+		if b.config.Metrics.Addr == "" {
+			b.config.Metrics.Addr = "127.0.0.1:2112"
+		}
+		slog.Info(fmt.Sprintf("Serving metrics at http://%v/metrics", b.config.Metrics.Addr))
+		go func(addr string){
+			if e := metrics.ListenAndServe(addr); e != nil {
+				slog.Error("Metrics server has stopped", "error", e)
+			}
+		}(b.config.Metrics.Addr)
+	}
+
+	if b.config.HTTP.Enabled {
+		go func(addr, token string){
+			if e := b.serveHTTP(addr, token); e != nil {
+				slog.Error("HTTP server has stopped", "error", e)
+			}
+		}(b.config.HTTP.Addr, b.config.HTTP.Token)
+	}
+
+	quitCh := make(chan bool)
+	go b.runConsole(console, quitCh)
+
+	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	go b.watchConfig(hupCh)
+
 	select {
-	case <-errCh:
-		break
+	case e = <-errCh:
 	case <-sigCh:
-		var inp string
-		fmt.Print("Close the lobby? [y/N]: ")
-		fmt.Scanln(&inp)
-		if inp == "y" {
-			fmt.Println("Closing the lobby")
-			b.conn.Send("PRIVMSG", b.lobby, "!mp", "close")
+		b.disconnect()
+	case closeLobby := <-quitCh:
+		if closeLobby {
+			slog.Info("Closing the lobby", "lobby", b.lobby)
+			b.mp(b.lobby, "close")
 			<-errCh
 		} else {
-			b.conn.Close()
+			b.disconnect()
+		}
+	}
+	b.notifier.Flush(5 * time.Second)
+	return e
+}
+
+func (b *Bot) connect() error {
+	b.mu.Lock()
+	d, c := b.dialer(), b.config.IRC
+	b.mu.Unlock()
+
+	slog.Info("Connecting to " + c.Addr)
+	conn, e := d.Connect(c.Addr, c.RateLimit)
+	if e != nil {
+		return e
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.quitting {
+		conn.Close()
+		return net.ErrClosed
+	}
+	b.conn = conn
+
+	slog.Info("Authenticating as " + b.config.IRC.User)
+	b.conn.Send("PASS", b.config.IRC.Pass)
+	b.conn.Send("NICK", b.config.IRC.User)
+	return nil
+}
+
+func (b *Bot) disconnect() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.quitting = true
+	b.conn.Close()
+}
+
+func (b *Bot) receive() error {
+	for {
+		var e error
+		var m irc.Msg
+		for m, e = b.conn.Recv(); e == nil; m, e = b.conn.Recv() {
+			b.handle(m)
+		}
+
+		b.mu.Lock()
+		fatal, quitting, authenticated := b.fatal, b.quitting, b.everAuthenticated
+		b.mu.Unlock()
+		if fatal != nil {
+			return fatal
+		}
+		if quitting || errors.Is(e, net.ErrClosed) {
+			return nil
+		}
+		if !authenticated {
+			return e
+		}
+
+		slog.Warn("Lost connection to the IRC server", "error", e)
+		events.Warn("disconnected", "lobby", b.lobby, "error", e.Error())
+		for delay := time.Second; ; delay = min(delay * 2, time.Minute) {
+			time.Sleep(delay)
+			if e = b.connect(); e == nil {
+				reconnects.Inc()
+				break
+			} else if errors.Is(e, net.ErrClosed) {
+				return e
+			}
+			slog.Warn("Failed to reconnect", "error", e)
 		}
 	}
 }
@@ -598,12 +1033,22 @@ const (
 	sourceRepository = "https://github.com/xfnty/osubot"
 )
 
+var console *Console
+
 func ReportPanic(b *Bot) {
 	if r := recover(); r != nil {
-		m := fmt.Sprintf("panic: %v\n\n%v", r, string(debug.Stack()))
-		os.WriteFile(crashPath, []byte(m), 0666)
-		fmt.Println(m)
+		m := redact(fmt.Sprintf("panic: %v\n\n%v", r, string(debug.Stack())))
+		r = redact(fmt.Sprint(r))
+		os.WriteFile(b.crashPath, []byte(m), 0600)
+		slog.Error("The bot has crashed", "panic", r)
+		events.Error("crash", "lobby", b.lobby, "panic", fmt.Sprint(r))
+		fmt.Fprintln(stdout, m)
+		if console != nil {
+			console.Close()
+		}
 		b.conn.Send("PRIVMSG", b.config.IRC.User, "The bot has crashed:", r)
+		b.notifier.Notify("crash", b.lobby, "", map[string]any{ "panic": fmt.Sprint(r), "fatal": true })
+		b.notifier.Flush(5 * time.Second)
 		os.Exit(1)
 	}
 }
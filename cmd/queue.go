@@ -0,0 +1,299 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"slices"
+	"strconv"
+	"strings"
+	"log/slog"
+)
+
+type queuePolicy interface {
+	order(waiting []Player, s *queueState)
+}
+
+type fifoPolicy struct{}
+
+type fairPolicy struct{}
+
+var queuePolicies = map[string]queuePolicy{
+	"fifo": fifoPolicy{},
+	"fair": fairPolicy{},
+}
+
+type queueState struct {
+	joined map[string]time.Time
+	hosted map[string]time.Time
+	left map[string]leftPlayer
+}
+
+type leftPlayer struct {
+	pos int
+	at time.Time
+}
+
+func (fifoPolicy) order(waiting []Player, s *queueState) {}
+
+func (fairPolicy) order(waiting []Player, s *queueState) {
+	slices.SortStableFunc(waiting, s.compareWaiting)
+}
+
+func (s *queueState) since(name string) time.Time {
+	if t, ok := s.hosted[name]; ok {
+		return t
+	}
+	return s.joined[name]
+}
+
+func (s *queueState) compareWaiting(a, b Player) int {
+	return s.since(a.Name).Compare(s.since(b.Name))
+}
+
+func (b *Bot) queuePolicy() queuePolicy {
+	if p, ok := queuePolicies[b.config.Room.QueuePolicy]; ok {
+		return p
+	}
+	return fifoPolicy{}
+}
+
+func (b *Bot) resetQueueState(players []Player) {
+	now := b.clock.Now()
+	b.queueState = queueState{
+		joined: map[string]time.Time{},
+		hosted: map[string]time.Time{},
+		left: map[string]leftPlayer{},
+	}
+	for _, p := range players {
+		b.queueState.joined[p.Name] = now
+	}
+}
+
+func (b *Bot) orderQueue() {
+	if len(b.queue) < 3 {
+		return
+	}
+	waiting := b.queue[1:]
+	b.queuePolicy().order(waiting, &b.queueState)
+
+	if boost := b.config.Room.BoostMinutes; boost > 0 {
+		cutoff := b.clock.Now().Add(-time.Duration(boost) * time.Minute)
+		var boosted, rest []Player
+		for _, p := range waiting {
+			if !p.AutoSkip && b.queueState.since(p.Name).Before(cutoff) {
+				boosted = append(boosted, p)
+			} else {
+				rest = append(rest, p)
+			}
+		}
+		slices.SortStableFunc(boosted, b.queueState.compareWaiting)
+		copy(waiting, slices.Concat(boosted, rest))
+	}
+}
+
+func (b *Bot) keepQueueOrder() {
+	if len(b.queue) < 3 {
+		return
+	}
+	s := &b.queueState
+	waiting := b.queue[1:]
+	times := make([]time.Time, 0, len(waiting))
+	for _, p := range waiting {
+		times = append(times, s.since(p.Name))
+	}
+	slices.SortFunc(times, time.Time.Compare)
+	for i, p := range waiting {
+		s.hosted[p.Name] = times[i]
+	}
+}
+
+func (b *Bot) addToQueue(name string) {
+	s := &b.queueState
+	now := b.clock.Now()
+
+	pos := len(b.queue)
+	grace := time.Duration(b.config.Room.GraceMinutes) * time.Minute
+	if l, ok := s.left[name]; ok && now.Sub(l.at) <= grace && len(b.queue) > 0 {
+		pos = min(max(l.pos, 1), len(b.queue))
+		slog.Info("The player has come back in time and keeps their spot", "user", name, "position", pos)
+	} else {
+		s.joined[name] = now
+	}
+	delete(s.left, name)
+
+	b.queue = slices.Insert(b.queue, pos, Player{ Name: name })
+	b.orderQueue()
+}
+
+func (b *Bot) removeFromQueue(name string) int {
+	i := slices.IndexFunc(b.queue, playerIndexFunc(name))
+	if i == -1 {
+		return -1
+	}
+	pos := i
+	if i == 0 {
+		pos = len(b.queue)
+	}
+	b.queueState.left[name] = leftPlayer{ pos: pos, at: b.clock.Now() }
+	b.queue = slices.Delete(b.queue, i, i+1)
+	return i
+}
+
+var queueSubcommands = []string{ "move", "swap", "remove", "front", "position" }
+
+func (b *Bot) onQueueCommand(lobby, user string, args []string, reply func(msg ...any)) {
+	sub, args := args[0], args[1:]
+	if sub == "position" {
+		reply(b.queuePosition(user))
+		return
+	}
+	if user != b.config.IRC.User {
+		reply("Only the owner can change the queue")
+		return
+	}
+	if len(b.queue) == 0 {
+		return
+	}
+
+	host := b.queue[0].Name
+	switch {
+	case sub == "move" && len(args) == 2:
+		pos, e := strconv.Atoi(args[1])
+		if e != nil || pos < 1 {
+			reply("Syntax: !q move name position")
+			return
+		}
+		i := b.findPlayer(args[0], reply)
+		if i == -1 {
+			return
+		}
+		b.movePlayer(i, pos)
+	case sub == "front" && len(args) == 1:
+		i := b.findPlayer(args[0], reply)
+		if i == -1 {
+			return
+		}
+		b.movePlayer(i, 1)
+	case sub == "swap" && len(args) == 2:
+		i, j := b.findPlayer(args[0], reply), b.findPlayer(args[1], reply)
+		if i == -1 || j == -1 {
+			return
+		}
+		b.queue[i], b.queue[j] = b.queue[j], b.queue[i]
+	case sub == "remove" && len(args) == 1:
+		i := b.findPlayer(args[0], reply)
+		if i == -1 {
+			return
+		}
+		b.queue[i].AutoSkip = true
+		if i == 0 && b.config.HR.Enabled && !b.mustDefineQueue && !b.matchInProgress {
+			b.rotateHost(lobby)
+			host = b.queue[0].Name
+		}
+	default:
+		reply("Syntax: !q move name position | swap name name | remove name | front name | position")
+		return
+	}
+
+	b.keepQueueOrder()
+	if b.queue[0].Name != host {
+		b.mp(lobby, "host", b.queue[0].Name)
+	}
+	slog.Info("Changed the queue", "command", sub, "args", args, "queue", formatQueue(b.queue))
+	reply("Queue:", formatQueue(b.queue))
+}
+
+func (b *Bot) findPlayer(name string, reply func(msg ...any)) int {
+	if i := slices.IndexFunc(b.queue, func(p Player) bool { return strings.EqualFold(p.Name, name) }); i != -1 {
+		return i
+	}
+	if i := findOnePlayerByApprox(name, b.queue); i != -1 {
+		return i
+	}
+
+	var matches []string
+	for _, p := range b.queue {
+		if strings.HasPrefix(strings.ToLower(p.Name), strings.ToLower(name)) {
+			matches = append(matches, p.Name)
+		}
+	}
+	if len(matches) == 0 {
+		reply(fmt.Sprintf("No player matches \"%v\".", name))
+	} else {
+		reply(fmt.Sprintf("\"%v\" matches %v, please type more of the name.", name, strings.Join(matches, ", ")))
+	}
+	return -1
+}
+
+func (b *Bot) movePlayer(i, pos int) {
+	p := b.queue[i]
+	p.AutoSkip = false
+	queue := slices.Delete(slices.Clone(b.queue), i, i+1)
+
+	j, n := len(queue), 0
+	for k := 1; k < len(queue); k++ {
+		if queue[k].AutoSkip {
+			continue
+		}
+		if n++; n == pos {
+			j = k
+			break
+		}
+	}
+	b.queue = slices.Insert(queue, j, p)
+}
+
+func (b *Bot) queuePosition(user string) string {
+	i := slices.IndexFunc(b.queue, playerIndexFunc(user))
+	switch {
+	case i == -1:
+		return user + ", you are not in the room."
+	case i == 0:
+		return user + ", you are the host."
+	case b.queue[i].AutoSkip:
+		return user + ", you are not in the host queue, type !joinqueue to join it."
+	}
+	pos := 0
+	for _, p := range b.queue[1:i+1] {
+		if !p.AutoSkip {
+			pos++
+		}
+	}
+	return fmt.Sprintf("%v, you are #%v in the host queue.", user, pos)
+}
+
+func (b *Bot) leaveQueue(lobby, user string, reply func(msg ...any)) {
+	i := slices.IndexFunc(b.queue, playerIndexFunc(user))
+	if i == -1 {
+		return
+	}
+	if b.queue[i].AutoSkip {
+		reply(user + ", you are not in the host queue.")
+		return
+	}
+	b.queue[i].AutoSkip = true
+	reply(user + " will play without hosting, type !joinqueue to host again.")
+	if i == 0 && b.config.HR.Enabled && !b.mustDefineQueue && !b.matchInProgress {
+		b.rotateHost(lobby)
+	}
+}
+
+func (b *Bot) joinQueue(user string, reply func(msg ...any)) {
+	i := slices.IndexFunc(b.queue, playerIndexFunc(user))
+	if i == -1 {
+		return
+	}
+	if !b.queue[i].AutoSkip {
+		reply(b.queuePosition(user))
+		return
+	}
+	p := b.queue[i]
+	p.AutoSkip = false
+	if i != 0 {
+		b.queue = append(slices.Delete(b.queue, i, i+1), p)
+		b.orderQueue()
+	} else {
+		b.queue[0] = p
+	}
+	reply(b.queuePosition(user))
+}
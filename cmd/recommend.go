@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+	"slices"
+	"context"
+	"log/slog"
+
+	"osubot/osu/api"
+)
+
+type Skill struct {
+	PP float32
+	Rank int
+	Stars float32
+}
+
+const topPlays = 10
+
+func estimateStars(u api.User, best []api.Score) float32 {
+	var sum float32
+	var n int
+	for _, s := range best {
+		if s.Beatmap != nil {
+			sum += s.Beatmap.Stars
+			n++
+		}
+	}
+	if n > 0 {
+		return sum / float32(n) - 0.5
+	}
+	if u.Statistics != nil {
+		return float32(1 + 1.1 * math.Log(1 + float64(u.Statistics.PP) / 250))
+	}
+	return 0
+}
+
+func (b *Bot) fetchSkill(lobby, user string) {
+	if !b.config.Recommendations.Enabled || user == b.config.IRC.User {
+		return
+	}
+
+	b.async(fmt.Sprintf("fetch skill %v", user), func(){
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10 * time.Second)
+		defer cancel()
+
+		u, e := b.api.GetUserByName(ctx, user)
+		if e != nil {
+			slog.Error("Failed to get user info", "user", user, "error", e)
+			return
+		}
+		best, e := b.api.GetUserBestScores(ctx, u.ID, api.ModeStandard, topPlays)
+		if e != nil {
+			slog.Warn("Failed to get user's top plays", "user", user, "error", e)
+		}
+
+		s := Skill{ Stars: estimateStars(u, best) }
+		if u.Statistics != nil {
+			s.PP = u.Statistics.PP
+			if u.Statistics.GlobalRank != nil {
+				s.Rank = *u.Statistics.GlobalRank
+			}
+		}
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if lobby != b.lobby || !slices.ContainsFunc(b.queue, playerIndexFunc(user)) {
+			return
+		}
+		if b.skills == nil {
+			b.skills = map[string]Skill{}
+		}
+		b.skills[user] = s
+		slog.Info("Estimated the player's skill", "user", user, "pp", s.PP, "rank", s.Rank, "stars", s.Stars)
+		b.updateSkillRange(lobby)
+	})
+}
+
+func (b *Bot) forgetSkill(lobby, user string) {
+	if _, ok := b.skills[user]; !ok {
+		return
+	}
+	delete(b.skills, user)
+	b.updateSkillRange(lobby)
+}
+
+func (b *Bot) suggestedRange() (r [2]float32, players int) {
+	var stars []float32
+	for _, p := range b.queue {
+		if s, ok := b.skills[p.Name]; ok && s.Stars > 0 {
+			stars = append(stars, s.Stars)
+		}
+	}
+	if len(stars) == 0 {
+		return
+	}
+	slices.Sort(stars)
+	median := stars[len(stars) / 2]
+	if len(stars) % 2 == 0 {
+		median = (stars[len(stars) / 2 - 1] + median) / 2
+	}
+
+	width := b.config.Recommendations.Width
+	if width == 0 {
+		width = 1
+	}
+	round := func(v float32) float32 { return float32(math.Round(float64(v) * 10)) / 10 }
+	return [2]float32{ round(max(median - width / 2, 0)), round(median + width / 2) }, len(stars)
+}
+
+func (b *Bot) updateSkillRange(lobby string) {
+	c := b.config.Recommendations
+	if !c.Enabled || !c.Auto || b.referee != nil {
+		return
+	}
+	r, players := b.suggestedRange()
+	if players == 0 {
+		return
+	}
+
+	hysteresis := c.Hysteresis
+	if hysteresis == 0 {
+		hysteresis = 0.3
+	}
+	current := b.config.DC.Range
+	center := (r[0] + r[1]) / 2
+	if math.Abs(float64(center - (current[0] + current[1]) / 2)) < float64(hysteresis) {
+		return
+	}
+
+	b.config.DC.Range = r
+	slog.Info("Changed the difficulty range to match the players", "lobby", lobby, "range", r, "players", players)
+	logEvent("skill range", lobby, "", "range", r, "players", players)
+	b.conn.Send(
+		"PRIVMSG",
+		lobby,
+		fmt.Sprintf("Difficulty range is now %v-%v* to match the players' skill", r[0], r[1]),
+	)
+}
+
+func (b *Bot) onRecommendCommand(lobby, user string, reply func(msg ...any)) {
+	if !b.config.Recommendations.Enabled {
+		reply("Recommendations are disabled in this room")
+		return
+	}
+	r, players := b.suggestedRange()
+	if players == 0 {
+		reply("The bot doesn't know the players' skill yet")
+		return
+	}
+	slog.Info("Recommending maps", "lobby", lobby, "user", user, "range", r, "players", players)
+	reply(fmt.Sprintf("Suggested difficulty: %v-%v*", r[0], r[1]))
+	b.searchBeatmaps(lobby, user, api.SearchQuery{
+		Mode: api.ModeStandard,
+		Status: "ranked",
+		MinStars: r[0],
+		MaxStars: r[1],
+		MaxLength: b.config.Requests.MaxLength,
+	}, reply)
+}
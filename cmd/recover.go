@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"slices"
+	"log/slog"
+	"runtime/debug"
+)
+
+func (b *Bot) recoverEvent(trigger string) {
+	if r := recover(); r != nil {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.reportRecoveredPanic(trigger, r, debug.Stack())
+	}
+}
+
+func (b *Bot) async(trigger string, f func()) {
+	b.pending.Add(1)
+	go func(){
+		defer b.pending.Done()
+		defer b.recoverEvent(trigger)
+		f()
+	}()
+}
+
+func (b *Bot) recoverCommand(trigger string) {
+	if r := recover(); r != nil {
+		b.reportRecoveredPanic(trigger, r, debug.Stack())
+	}
+}
+
+func (b *Bot) reportRecoveredPanic(trigger string, r any, stack []byte) {
+	state := fmt.Sprintf(
+		"lobby: %v\nqueue: %v\nbeatmap: %v\nmatch in progress: %v\nhost rotation: %v\nmust define queue: %v",
+		b.lobby,
+		b.queue,
+		b.beatmap.ID,
+		b.matchInProgress,
+		b.config.HR.Enabled,
+		b.mustDefineQueue,
+	)
+	report := redact(fmt.Sprintf(
+		"%v\npanic: %v\ntrigger: %v\n%v\n\n%v\n",
+		b.clock.Now().Format(time.RFC3339),
+		r,
+		trigger,
+		state,
+		string(stack),
+	))
+	r = redact(fmt.Sprint(r))
+	if b.crashPath != "" {
+		if f, e := os.OpenFile(b.crashPath, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0600); e == nil {
+			f.WriteString(report)
+			f.Close()
+		}
+	}
+	b.panics++
+
+	slog.Error("Recovered from a panic", "panic", r, "trigger", trigger, "lobby", b.lobby, "queue", b.queue)
+	events.Error("panic", "lobby", b.lobby, "panic", fmt.Sprint(r), "trigger", trigger)
+
+	b.conn.Send("PRIVMSG", b.config.IRC.User, "The bot has recovered from a crash:", r)
+	b.notifier.Notify("crash", b.lobby, "", map[string]any{ "panic": fmt.Sprint(r), "trigger": trigger })
+	if b.lobby != "" {
+		b.mp(b.lobby, "settings")
+	}
+}
+
+func (b *Bot) OnSettingsPlayers(lobby string, count int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.syncCount = count
+	b.syncSlots = b.syncSlots[:0]
+	b.syncHost = ""
+	if count == 0 {
+		b.applySync()
+	}
+}
+
+func (b *Bot) OnSettingsSlot(lobby string, slot int, user string, host bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.syncSlots = append(b.syncSlots, user)
+	if host {
+		b.syncHost = user
+	}
+	if len(b.syncSlots) == b.syncCount {
+		b.applySync()
+	}
+}
+
+func (b *Bot) applySync() {
+	queue := make([]Player, 0, len(b.syncSlots))
+	for _, p := range b.queue {
+		if slices.Contains(b.syncSlots, p.Name) {
+			queue = append(queue, p)
+		}
+	}
+	for _, name := range b.syncSlots {
+		if !slices.ContainsFunc(queue, playerIndexFunc(name)) {
+			queue = append(queue, Player{ Name: name })
+			b.queueState.joined[name] = b.clock.Now()
+			b.fetchSkill(b.lobby, name)
+		}
+	}
+	if i := slices.IndexFunc(queue, playerIndexFunc(b.syncHost)); i > 0 {
+		queue = slices.Concat(queue[i:], queue[:i])
+	}
+
+	b.queue = queue
+	if len(b.queue) <= 1 {
+		b.mustDefineQueue = false
+	}
+	slog.Info("Synchronized the room state", "lobby", b.lobby, "queue", formatQueue(b.queue))
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"time"
+	"bytes"
+	"slices"
+	"strings"
+	"reflect"
+	"log/slog"
+
+	"osubot"
+)
+
+func (b *Bot) watchConfig(hupCh <-chan os.Signal) {
+	last, _ := os.ReadFile(b.configPath)
+	t := time.NewTicker(2 * time.Second)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-hupCh:
+			slog.Info("Reloading " + b.configPath)
+		case <-t.C:
+			data, e := os.ReadFile(b.configPath)
+			if e != nil || bytes.Equal(data, last) {
+				continue
+			}
+			last = data
+		}
+		if e := b.reloadConfig(); e != nil {
+			slog.Error("Failed to reload " + b.configPath + ", keeping the current settings", "error", e)
+		}
+	}
+}
+
+func (b *Bot) reloadConfig() error {
+	var c osubot.Config
+	if e := c.LoadFile(b.configPath); e != nil {
+		return e
+	}
+	if e := b.overrideConfig(&c); e != nil {
+		return e
+	}
+	if e := c.WithOverrides().Validate(); e != nil {
+		return e
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c.Version = b.fileConfig.Version
+	if reflect.DeepEqual(c, b.fileConfig) {
+		return nil
+	}
+	if b.moderator != nil {
+		if e := b.moderator.configure(c); e != nil {
+			return e
+		}
+	}
+
+	old, prev, next := b.config, b.fileConfig.WithOverrides(), c.WithOverrides()
+
+	var reconnect, restart []string
+	for _, f := range []struct{ name string; old, new any; reconnect bool }{
+		{ "irc", old.IRC, next.IRC, true },
+		{ "api", old.API, next.API, false },
+		{ "webhooks", old.Webhooks, next.Webhooks, false },
+		{ "tournament", old.Tournament, next.Tournament, false },
+		{ "http", old.HTTP, next.HTTP, false },
+		{ "metrics", old.Metrics, next.Metrics, false },
+		{ "record", old.Record, next.Record, false },
+		{ "log", old.Log, next.Log, false },
+	} {
+		if reflect.DeepEqual(f.old, f.new) {
+			continue
+		}
+		if f.reconnect {
+			reconnect = append(reconnect, f.name)
+		} else {
+			restart = append(restart, f.name)
+		}
+	}
+
+	b.fileConfig = c
+	b.config.IRC = next.IRC
+	b.config.Overrides = next.Overrides
+	b.config.HR = next.HR
+	if !reflect.DeepEqual(prev.DC, next.DC) {
+		b.config.DC = next.DC
+	}
+	if b.referee != nil || b.mustDefineQueue {
+		b.config.HR.Enabled = false
+	}
+	if b.referee != nil {
+		b.config.DC.Enabled = false
+	}
+	b.config.Moderation = next.Moderation
+	b.config.Commands = next.Commands
+	b.config.Requests = next.Requests
+	b.config.Recommendations = next.Recommendations
+	b.config.Room = next.Room
+	if b.lobby != "" {
+		b.applyRoomChanges(b.lobby, old)
+		b.orderQueue()
+	}
+
+	slog.Info(
+		"Reloaded " + b.configPath,
+		"host_rotation", b.config.HR.Enabled,
+		"difficulty_constraint", b.config.DC.Enabled,
+		"range", b.config.DC.Range,
+	)
+	logEvent("config reloaded", b.lobby, "")
+	if len(reconnect) > 0 {
+		slog.Warn("Changed settings will be applied after reconnecting", "sections", strings.Join(reconnect, ", "))
+	}
+	if len(restart) > 0 {
+		slog.Warn("Changed settings will be applied after a restart", "sections", strings.Join(restart, ", "))
+	}
+	return nil
+}
+
+func (b *Bot) applyRoomChanges(lobby string, c osubot.Config) {
+	r, old := b.config.Room, c.Room
+	if r.Name != old.Name {
+		b.mp(lobby, "name", b.roomName())
+	}
+	if r.Password != old.Password {
+		b.mp(lobby, "password", r.Password)
+	}
+	if r.Size != old.Size || r.TeamMode != old.TeamMode || r.ScoreMode != old.ScoreMode {
+		b.mp(lobby, append([]any{ "set" }, b.roomSet()...)...)
+	}
+	if !slices.Equal(r.Mods, old.Mods) || (r.Mods == nil) != (old.Mods == nil) {
+		b.mp(lobby, append([]any{ "mods" }, b.roomMods()...)...)
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"fmt"
+	"time"
+	"sync"
+	"bytes"
+	"strings"
+	"path/filepath"
+	"encoding/json"
+
+	"osubot"
+	"osubot/osu/api"
+	"osubot/osu/irc"
+	"osubot/recording"
+)
+
+type recordedState struct {
+	Config osubot.Config          `json:"config"`
+	Cache osubot.Cache            `json:"cache"`
+	Tournament *osubot.Tournament `json:"tournament,omitempty"`
+}
+
+func (b *Bot) startRecording(dir string) (*recording.Recorder, error) {
+	if e := os.MkdirAll(dir, 0755); e != nil {
+		return nil, e
+	}
+	path := filepath.Join(dir, time.Now().Format("2006-01-02T15-04-05") + ".jsonl")
+	f, e := os.OpenFile(path, os.O_WRONLY | os.O_CREATE | os.O_TRUNC, 0600)
+	if e != nil {
+		return nil, e
+	}
+
+	s := recordedState{ Config: b.config, Cache: b.cache }
+	s.Config.IRC.Pass, s.Config.API.Secret, s.Config.HTTP.Token = "", "", ""
+	s.Config.IRC.Proxy, s.Config.Webhooks = "", nil
+	if b.referee != nil {
+		s.Tournament = &b.referee.t
+	}
+	body, e := json.Marshal(s)
+	if e != nil {
+		return nil, e
+	}
+
+	rec := recording.NewRecorder(f)
+	rec.Record(recording.Entry{ Dir: recording.DirStart, Body: string(body) })
+	return rec, nil
+}
+
+type replayConn struct {
+	in chan string
+	buf []byte
+	mu sync.Mutex
+	out bytes.Buffer
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	if len(c.buf) == 0 {
+		c.buf = []byte(<-c.in + "\n")
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
+
+func (c *replayConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.out.Write(p)
+}
+
+func (c *replayConn) lines() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.out.Len() == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(c.out.String(), "\n"), "\n")
+}
+
+func (c *replayConn) Close() error {
+	return nil
+}
+
+func replay(path string) (ok bool, e error) {
+	entries, e := recording.LoadFile(path)
+	if e != nil {
+		return
+	}
+	if len(entries) == 0 || entries[0].Dir != recording.DirStart {
+		return false, fmt.Errorf("%v is not a recording", path)
+	}
+
+	var s recordedState
+	if e = json.Unmarshal([]byte(entries[0].Body), &s); e != nil {
+		return
+	}
+
+	clock := &virtualClock{ now: entries[0].Time }
+	conn := &replayConn{ in: make(chan string, 1) }
+	b := &Bot{ clock: clock, config: s.Config, fileConfig: s.Config, cache: s.Cache }
+	b.bus = b.newBus()
+	if s.Tournament != nil {
+		b.referee = NewReferee(*s.Tournament)
+	}
+	mod, e := NewModerator(b, b.config)
+	if e != nil {
+		return
+	}
+	b.bus.Subscribe(mod)
+	b.conn = irc.NewConn(conn, 0)
+	b.api = api.NewClient("http://replay", "", "")
+	b.api.SetTransport(recording.NewReplayTransport(entries))
+
+	b.conn.Send("PASS", "***")
+	b.conn.Send("NICK", b.config.IRC.User)
+
+	var recorded []string
+	inbound, panicked := 0, false
+	for _, entry := range entries[1:] {
+		if entry.Dir == recording.DirOut {
+			recorded = append(recorded, entry.Line)
+			continue
+		}
+		if entry.Dir != recording.DirIn {
+			continue
+		}
+
+		inbound++
+		clock.Advance(entry.Time)
+		b.pending.Wait()
+		conn.in <- entry.Line
+		m, e := b.conn.Recv()
+		if e != nil {
+			return false, e
+		}
+		panics := b.panics
+		b.handle(m)
+		b.pending.Wait()
+		if b.panics != panics {
+			panicked = true
+			fmt.Printf("panic at %v while handling %q\n", entry.Time.Format(time.TimeOnly), entry.Line)
+		}
+	}
+	clock.Advance(entries[len(entries)-1].Time)
+	b.pending.Wait()
+
+	replayed := conn.lines()
+	diff := diffLines(recorded, replayed)
+	for _, l := range diff {
+		fmt.Println(l)
+	}
+	fmt.Printf(
+		"Replayed %v inbound lines, %v recorded and %v replayed outbound lines, %v differences\n",
+		inbound,
+		len(recorded),
+		len(replayed),
+		len(diff),
+	)
+	return len(diff) == 0 && !panicked, nil
+}
+
+func diffLines(a, b []string) []string {
+	lcs := make([][]int, len(a) + 1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b) + 1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		if i < len(a) && j < len(b) && a[i] == b[j] {
+			i, j = i+1, j+1
+		} else if j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]) {
+			out = append(out, "+ " + b[j])
+			j++
+		} else {
+			out = append(out, "- " + a[i])
+			i++
+		}
+	}
+	return out
+}
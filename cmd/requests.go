@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"regexp"
+	"slices"
+	"context"
+	"strconv"
+	"strings"
+	"log/slog"
+
+	"osubot/osu/api"
+)
+
+type Request struct {
+	User string
+	Beatmap api.Beatmap
+	Time time.Time
+}
+
+var beatmapLinkRe = regexp.MustCompile(`^(?:https?://)?osu\.ppy\.sh/(?:b/|beatmaps/|beatmapsets/\d+#\w+/)(\d+)`)
+
+func parseBeatmapID(s string) (int, bool) {
+	if g := beatmapLinkRe.FindStringSubmatch(s); g != nil {
+		s = g[1]
+	}
+	id, e := strconv.Atoi(s)
+	return id, e == nil && id > 0
+}
+
+func (b *Bot) checkBeatmap(bm api.Beatmap) string {
+	if b.config.DC.Enabled {
+		if bm.Stars < b.config.DC.Range[0] {
+			return fmt.Sprintf("too easy (%.2f<%v*)", bm.Stars, b.config.DC.Range[0])
+		}
+		if bm.Stars > b.config.DC.Range[1] {
+			return fmt.Sprintf("too hard (%.2f>%v*)", bm.Stars, b.config.DC.Range[1])
+		}
+	}
+	if max := b.config.Requests.MaxLength; max > 0 && bm.Length > max {
+		return fmt.Sprintf("too long (%v>%v)", formatDuration(time.Duration(bm.Length) * time.Second), formatDuration(time.Duration(max) * time.Second))
+	}
+	return ""
+}
+
+func (b *Bot) onRequestCommand(lobby, user string, args []string, reply func(msg ...any)) {
+	if !b.config.Requests.Enabled {
+		reply("Map requests are disabled in this room")
+		return
+	}
+	if len(args) != 1 {
+		reply("Syntax: !request beatmap link or ID")
+		return
+	}
+	id, ok := parseBeatmapID(args[0])
+	if !ok {
+		reply(user + ", that doesn't look like a link to a beatmap difficulty.")
+		return
+	}
+	if i := slices.IndexFunc(b.requests, func(r Request) bool { return r.Beatmap.ID == id }); i != -1 {
+		reply(fmt.Sprintf("%v, %v has already been requested by %v.", user, formatBeatmap(b.requests[i].Beatmap), b.requests[i].User))
+		return
+	}
+	pending := 0
+	for _, r := range b.requests {
+		if r.User == user {
+			pending++
+		}
+	}
+	if max := b.config.Requests.MaxPerPlayer; max > 0 && pending >= max && user != b.config.IRC.User {
+		reply(fmt.Sprintf("%v, you already have %v pending requests.", user, pending))
+		return
+	}
+
+	b.async(fmt.Sprintf("%v: !request %v", user, id), func(){
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+		defer cancel()
+		bm, e := b.api.GetBeatmap(ctx, id)
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if e != nil {
+			slog.Error("Failed to fetch beatmap info", "id", id, "error", e)
+			reply(fmt.Sprintf("%v, couldn't find the beatmap %v.", user, id))
+			return
+		}
+		if reason := b.checkBeatmap(bm); reason != "" {
+			logRejection("Rejecting request", lobby, user, "beatmap", formatBeatmap(bm), "reason", reason)
+			mapsRejected.With("request").Inc()
+			reply(fmt.Sprintf("%v, %v is %v.", user, formatBeatmap(bm), reason))
+			return
+		}
+		if slices.ContainsFunc(b.requests, func(r Request) bool { return r.Beatmap.ID == id }) {
+			return
+		}
+
+		b.requests = append(b.requests, Request{ User: user, Beatmap: bm, Time: b.clock.Now() })
+		logEvent("request", lobby, user, "beatmap", formatBeatmap(bm), "id", bm.ID)
+		pos := slices.IndexFunc(b.orderedRequests(), func(r Request) bool { return r.Beatmap.ID == id }) + 1
+		reply(fmt.Sprintf("%v requested %v, #%v in the request queue.", user, formatBeatmap(bm), pos))
+	})
+}
+
+func (b *Bot) onRequestsCommand(lobby, user string, args []string, reply func(msg ...any)) {
+	switch {
+	case len(args) == 0:
+		requests := b.orderedRequests()
+		if len(requests) == 0 {
+			reply("No pending requests")
+			return
+		}
+		items := make([]string, 0, min(len(requests), 5))
+		for i, r := range requests[:min(len(requests), 5)] {
+			items = append(items, fmt.Sprintf("%v. %v (%v)", i+1, formatBeatmap(r.Beatmap), r.User))
+		}
+		if len(requests) > 5 {
+			items = append(items, fmt.Sprintf("and %v more", len(requests) - 5))
+		}
+		reply("Requests:", strings.Join(items, ", "))
+	case len(args) == 1 && args[0] == "next" && user == b.config.IRC.User:
+		if !b.playNextRequest(lobby) {
+			reply("No pending requests")
+		}
+	case len(args) == 1 && args[0] == "clear" && user == b.config.IRC.User:
+		b.requests = nil
+		reply("Cleared the requests")
+	default:
+		reply("Syntax: !requests [next/clear]")
+	}
+}
+
+func (b *Bot) orderedRequests() []Request {
+	now := b.clock.Now()
+	pending := slices.Clone(b.requests)
+	served := map[string]time.Time{}
+	for name, t := range b.requestServed {
+		served[name] = t
+	}
+
+	ordered := make([]Request, 0, len(pending))
+	for len(pending) > 0 {
+		next := 0
+		for i, r := range pending[1:] {
+			if served[r.User].Before(served[pending[next].User]) {
+				next = i + 1
+			}
+		}
+		r := pending[next]
+		ordered = append(ordered, r)
+		pending = slices.Delete(pending, next, next+1)
+		served[r.User] = now.Add(time.Duration(len(ordered)))
+	}
+	return ordered
+}
+
+func (b *Bot) playNextRequest(lobby string) bool {
+	for _, r := range b.orderedRequests() {
+		b.requests = slices.DeleteFunc(b.requests, func(p Request) bool { return p.Beatmap.ID == r.Beatmap.ID })
+		if reason := b.checkBeatmap(r.Beatmap); reason != "" {
+			logRejection("Skipping request", lobby, r.User, "beatmap", formatBeatmap(r.Beatmap), "reason", reason)
+			continue
+		}
+
+		if b.requestServed == nil {
+			b.requestServed = map[string]time.Time{}
+		}
+		b.requestServed[r.User] = b.clock.Now()
+		slog.Info("Playing the next request", "lobby", lobby, "user", r.User, "beatmap", formatBeatmap(r.Beatmap))
+		b.mp(lobby, "map", r.Beatmap.ID)
+		b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("Next map: %v requested by %v", formatBeatmap(r.Beatmap), r.User))
+		return true
+	}
+	return false
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"log/slog"
+	"text/template"
+
+	"osubot"
+)
+
+func formatRoomName(name, user string) (string, error) {
+	if name == "" {
+		name = "{{.User}}'s game"
+	}
+	t, e := template.New("room").Parse(name)
+	if e != nil {
+		return "", e
+	}
+	var sb strings.Builder
+	if e = t.Execute(&sb, struct{ User string }{ user }); e != nil {
+		return "", e
+	}
+	return sb.String(), nil
+}
+
+func (b *Bot) roomName() string {
+	name, e := formatRoomName(b.config.Room.Name, b.config.IRC.User)
+	if e != nil {
+		slog.Warn("Invalid room name template", "name", b.config.Room.Name, "error", e)
+		return b.config.IRC.User + "'s game"
+	}
+	return name
+}
+
+func (b *Bot) makeRoom() {
+	slog.Info("Creating new lobby")
+	b.mp("BanchoBot", "make", b.roomName())
+}
+
+func (b *Bot) setupRoom(lobby string) {
+	r := b.config.Room
+	if r.Password != "" {
+		b.mp(lobby, "password", r.Password)
+	} else {
+		b.mp(lobby, "password")
+	}
+	b.mp(lobby, append([]any{ "set" }, b.roomSet()...)...)
+	b.mp(lobby, append([]any{ "mods" }, b.roomMods()...)...)
+	for _, name := range b.roomInvites() {
+		b.mp(lobby, "invite", name)
+	}
+	if r.Beatmap != 0 {
+		b.mp(lobby, "map", r.Beatmap)
+	}
+}
+
+func (b *Bot) roomModes() (team, score, size int) {
+	r := b.config.Room
+	size = r.Size
+	if size == 0 {
+		size = 8
+	}
+	return max(slices.Index(osubot.TeamModes, r.TeamMode), 0), max(slices.Index(osubot.ScoreModes, r.ScoreMode), 0), size
+}
+
+func (b *Bot) roomSet() []any {
+	team, score, size := b.roomModes()
+	return []any{ team, score, size }
+}
+
+func (b *Bot) roomMods() []any {
+	if b.config.Room.Mods == nil {
+		return []any{ "Freemod" }
+	}
+	if len(b.config.Room.Mods) == 0 {
+		return []any{ "None" }
+	}
+	return toAnySlice(b.config.Room.Mods)
+}
+
+func (b *Bot) queuePolicyName() string {
+	if b.config.Room.QueuePolicy == "" {
+		return osubot.QueuePolicies[0]
+	}
+	return b.config.Room.QueuePolicy
+}
+
+func (b *Bot) roomInvites() []string {
+	if b.config.Room.Invite == nil {
+		return []string{ b.config.IRC.User }
+	}
+	return b.config.Room.Invite
+}
+
+func (b *Bot) onRoomCommand(lobby string, args []string, reply func(msg ...any)) {
+	r := &b.config.Room
+	if len(args) == 0 {
+		team, score, size := b.roomModes()
+		password := "none"
+		if r.Password != "" {
+			password = "set"
+		}
+		reply(
+			fmt.Sprintf(
+				"Room: name \"%v\", password %v, size %v, team %v, score %v, mods %v, invite %v, map %v, " +
+				"queue %v, boost %v min, grace %v min",
+				b.roomName(),
+				password,
+				size,
+				osubot.TeamModes[team],
+				osubot.ScoreModes[score],
+				b.roomMods(),
+				b.roomInvites(),
+				r.Beatmap,
+				b.queuePolicyName(),
+				r.BoostMinutes,
+				r.GraceMinutes,
+			),
+		)
+		return
+	}
+
+	setting, values := args[0], args[1:]
+	switch {
+	case setting == "name" && len(values) > 0:
+		name := strings.Join(values, " ")
+		if _, e := formatRoomName(name, b.config.IRC.User); e != nil {
+			reply("Invalid room name:", e)
+			return
+		}
+		r.Name = name
+		b.mp(lobby, "name", b.roomName())
+	case setting == "password":
+		r.Password = strings.Join(values, " ")
+		b.mp(lobby, "password", r.Password)
+	case setting == "size" && len(values) == 1:
+		size, e := strconv.Atoi(values[0])
+		if e != nil || size < 1 || size > 16 {
+			reply("Size must be between 1 and 16")
+			return
+		}
+		r.Size = size
+		b.mp(lobby, "size", size)
+	case setting == "team" && len(values) == 1:
+		i := slices.IndexFunc(osubot.TeamModes, equalFoldFunc(values[0]))
+		if i == -1 {
+			reply("Team mode is one of", strings.Join(osubot.TeamModes, ", "))
+			return
+		}
+		r.TeamMode = osubot.TeamModes[i]
+		b.mp(lobby, append([]any{ "set" }, b.roomSet()...)...)
+	case setting == "score" && len(values) == 1:
+		i := slices.IndexFunc(osubot.ScoreModes, equalFoldFunc(values[0]))
+		if i == -1 {
+			reply("Score mode is one of", strings.Join(osubot.ScoreModes, ", "))
+			return
+		}
+		r.ScoreMode = osubot.ScoreModes[i]
+		b.mp(lobby, append([]any{ "set" }, b.roomSet()...)...)
+	case setting == "mods":
+		r.Mods = slices.Clone(values)
+		if r.Mods == nil {
+			r.Mods = []string{}
+		}
+		b.mp(lobby, append([]any{ "mods" }, b.roomMods()...)...)
+	case setting == "invite":
+		r.Invite = slices.Clone(values)
+		if r.Invite == nil {
+			r.Invite = []string{}
+		}
+	case setting == "map" && len(values) == 1:
+		id, e := strconv.Atoi(values[0])
+		if e != nil || id < 0 {
+			reply("Syntax: !room map id")
+			return
+		}
+		r.Beatmap = id
+	case setting == "queue" && len(values) == 1:
+		i := slices.IndexFunc(osubot.QueuePolicies, equalFoldFunc(values[0]))
+		if i == -1 {
+			reply("Queue policy is one of", strings.Join(osubot.QueuePolicies, ", "))
+			return
+		}
+		r.QueuePolicy = osubot.QueuePolicies[i]
+		b.orderQueue()
+	case (setting == "boost" || setting == "grace") && len(values) == 1:
+		minutes, e := strconv.Atoi(values[0])
+		if e != nil || minutes < 0 {
+			reply(fmt.Sprintf("Syntax: !room %v minutes", setting))
+			return
+		}
+		if setting == "boost" {
+			r.BoostMinutes = minutes
+			b.orderQueue()
+		} else {
+			r.GraceMinutes = minutes
+		}
+	default:
+		reply("Syntax: !room [name/password/size/team/score/mods/invite/map/queue/boost/grace value...]")
+		return
+	}
+
+	slog.Info("Changed room settings", "setting", setting, "value", strings.Join(values, " "))
+	room := b.config.Room
+	b.updateConfigFile(func(c *osubot.Config){ c.Room = room })
+}
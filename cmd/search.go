@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"context"
+	"strconv"
+	"strings"
+	"log/slog"
+
+	"osubot/osu/api"
+)
+
+const searchResults = 5
+
+func (b *Bot) onSearchCommand(lobby, user string, args []string, reply func(msg ...any)) {
+	if len(args) == 0 {
+		reply("Syntax: !search query")
+		return
+	}
+
+	q := api.SearchQuery{
+		Query: strings.Join(args, " "),
+		Mode: api.ModeStandard,
+		Status: "ranked",
+		MaxLength: b.config.Requests.MaxLength,
+	}
+	if b.config.DC.Enabled {
+		q.MinStars, q.MaxStars = b.config.DC.Range[0], b.config.DC.Range[1]
+	}
+	b.searchBeatmaps(lobby, user, q, reply)
+}
+
+func (b *Bot) searchBeatmaps(lobby, user string, q api.SearchQuery, reply func(msg ...any)) {
+	b.async(fmt.Sprintf("%v: search %v", user, q.Query), func(){
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
+		defer cancel()
+		r, e := b.api.SearchBeatmapSets(ctx, q)
+
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		if e != nil {
+			slog.Error("Failed to search for beatmaps", "query", q.Query, "error", e)
+			reply("Couldn't search for beatmaps right now.")
+			return
+		}
+
+		var results []api.Beatmap
+		for _, set := range r.BeatmapSets {
+			for _, bm := range set.Beatmaps {
+				if bm.Mode != api.ModeStandard || b.checkBeatmap(bm) != "" {
+					continue
+				}
+				bs := set
+				bs.Beatmaps = nil
+				bm.BeatmapSet = &bs
+				results = append(results, bm)
+				break
+			}
+			if len(results) == searchResults {
+				break
+			}
+		}
+
+		b.searchResults = results
+		logEvent("search", lobby, user, "query", q.Query, "results", len(results))
+		if len(results) == 0 {
+			reply("No maps found within the room's constraints.")
+			return
+		}
+		for i, bm := range results {
+			reply(
+				fmt.Sprintf(
+					"%v. [https://osu.ppy.sh/b/%v %v] %.2f* %v",
+					i+1,
+					bm.ID,
+					formatBeatmap(bm),
+					bm.Stars,
+					formatDuration(time.Duration(bm.Length) * time.Second),
+				),
+			)
+		}
+		reply("The host can pick one with !pick number")
+	})
+}
+
+func (b *Bot) onPickCommand(lobby, user string, args []string, reply func(msg ...any)) {
+	if len(b.queue) == 0 || (user != b.queue[0].Name && user != b.config.IRC.User) {
+		reply(user + ", only the host can pick a map.")
+		return
+	}
+	if len(args) != 1 {
+		reply("Syntax: !pick number")
+		return
+	}
+	n, e := strconv.Atoi(args[0])
+	if e != nil {
+		reply("Syntax: !pick number")
+		return
+	}
+	if n < 1 || n > len(b.searchResults) {
+		reply(fmt.Sprintf("There is no search result #%v, use !search first.", n))
+		return
+	}
+
+	bm := b.searchResults[n-1]
+	slog.Info("Picking a search result", "lobby", lobby, "user", user, "beatmap", formatBeatmap(bm))
+	b.mp(lobby, "map", bm.ID)
+}
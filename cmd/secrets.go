@@ -0,0 +1,142 @@
+package main
+
+import (
+	"io"
+	"os"
+	"fmt"
+	"sync"
+	"errors"
+	"runtime"
+	"strings"
+	"log/slog"
+
+	"osubot"
+
+	"golang.org/x/term"
+)
+
+var redactor struct {
+	mu sync.RWMutex
+	r *strings.Replacer
+}
+
+func (b *Bot) overrideConfig(c *osubot.Config) error {
+	if e := c.LoadSecrets(); e != nil {
+		return e
+	}
+	c.LoadEnv()
+	if c.Encrypted() {
+		if b.passphrase == "" {
+			b.passphrase = os.Getenv("OSUBOT_PASSPHRASE")
+		}
+		if b.passphrase == "" && console == nil && term.IsTerminal(int(os.Stdin.Fd())) {
+			b.passphrase = readSecret("Passphrase: ")
+		}
+		if b.passphrase == "" {
+			return errors.New("The secrets are encrypted, set OSUBOT_PASSPHRASE to decrypt them")
+		}
+		if e := c.Decrypt(b.passphrase); e != nil {
+			return e
+		}
+	}
+	if b.logLevel != "" {
+		c.Log.Level = b.logLevel
+	}
+	setSecrets(c.SecretValues())
+	return nil
+}
+
+func checkPermissions(path string, c osubot.Config) {
+	if runtime.GOOS == "windows" || len(c.SecretValues()) == 0 || c.Encrypted() {
+		return
+	}
+	if info, e := os.Stat(path); e == nil && info.Mode().Perm() & 0077 != 0 {
+		slog.Warn(path + " contains secrets and is readable by other users, consider running chmod 600 " + path)
+	}
+}
+
+func readSecret(prompt string) string {
+	fmt.Print(prompt)
+	defer fmt.Println()
+	b, e := term.ReadPassword(int(os.Stdin.Fd()))
+	if e != nil {
+		return ""
+	}
+	return string(b)
+}
+
+func setSecrets(values []string) {
+	var pairs []string
+	for _, v := range values {
+		if len(v) >= 4 {
+			pairs = append(pairs, v, "[redacted]")
+		}
+	}
+	redactor.mu.Lock()
+	defer redactor.mu.Unlock()
+	redactor.r = strings.NewReplacer(pairs...)
+}
+
+func redact(s string) string {
+	redactor.mu.RLock()
+	defer redactor.mu.RUnlock()
+	if redactor.r == nil {
+		return s
+	}
+	return redactor.r.Replace(s)
+}
+
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, e := io.WriteString(w.w, redact(string(p))); e != nil {
+		return 0, e
+	}
+	return len(p), nil
+}
+
+func encryptSecrets(path string) error {
+	var c osubot.Config
+	if e := c.LoadFile(path); e != nil {
+		return e
+	}
+	var s osubot.Secrets
+	if c.Secrets != "" {
+		if e := s.LoadFile(c.Secrets); e != nil {
+			return e
+		}
+	}
+
+	passphrase := os.Getenv("OSUBOT_PASSPHRASE")
+	if passphrase == "" {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return errors.New("Set OSUBOT_PASSPHRASE or run the command in a terminal")
+		}
+		passphrase = readSecret("New passphrase: ")
+		if readSecret("Repeat the passphrase: ") != passphrase {
+			return errors.New("The passphrases don't match")
+		}
+	}
+	if passphrase == "" {
+		return errors.New("The passphrase must not be empty")
+	}
+
+	if e := c.Encrypt(passphrase); e != nil {
+		return e
+	}
+	if e := c.SaveFile(path); e != nil {
+		return e
+	}
+	if c.Secrets != "" {
+		if e := s.Encrypt(passphrase); e != nil {
+			return e
+		}
+		if e := s.SaveFile(c.Secrets); e != nil {
+			return e
+		}
+	}
+	fmt.Println("Encrypted the secrets in", path)
+	return nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"log/slog"
+
+	"osubot"
+)
+
+func (b *Bot) updateConfigFile(update func(c *osubot.Config)) {
+	update(&b.fileConfig)
+	if b.configPath == "" {
+		return
+	}
+
+	var c osubot.Config
+	if e := c.LoadFile(b.configPath); e != nil {
+		slog.Error("Failed to update " + b.configPath, "error", e)
+		return
+	}
+	update(&c)
+	if e := c.SaveFile(b.configPath); e != nil {
+		slog.Error("Failed to update " + b.configPath, "error", e)
+	}
+}
+
+func (b *Bot) saveOverrides() {
+	o := b.config.Overrides
+	b.updateConfigFile(func(c *osubot.Config){ c.Overrides = o })
+}
+
+func (b *Bot) resetSettings() {
+	b.config.Overrides = osubot.Overrides{}
+	b.config.HR = b.fileConfig.HR
+	b.config.DC = b.fileConfig.DC
+	if b.referee != nil || b.mustDefineQueue {
+		b.config.HR.Enabled = false
+	}
+	if b.referee != nil {
+		b.config.DC.Enabled = false
+	}
+	b.saveOverrides()
+	slog.Info("Settings were reset to the defaults from the config file")
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
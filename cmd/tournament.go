@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"time"
+	"slices"
+	"strings"
+	"log/slog"
+
+	"osubot"
+)
+
+type Referee struct {
+	t osubot.Tournament
+	started bool
+	step int
+	lastPicker int
+	turn int
+	action string
+	timer Timer
+	picked []string
+	banned []string
+	current string
+	points [2]int
+	scores [2]int
+}
+
+var bracketMods = map[string][]string{
+	"NM": {},
+	"HD": {"HD"},
+	"HR": {"HR"},
+	"DT": {"DT"},
+	"EZ": {"EZ"},
+	"FL": {"FL"},
+	"FM": {"Freemod"},
+	"TB": {"Freemod"},
+}
+
+func NewReferee(t osubot.Tournament) *Referee {
+	return &Referee{ t: t, lastPicker: 1 }
+}
+
+func (r *Referee) teamOf(user string) int {
+	for i, t := range r.t.Teams {
+		if sameUser(t.Captain, user) || slices.ContainsFunc(t.Players, func(p string) bool { return sameUser(p, user) }) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Referee) available() []string {
+	slots := make([]string, 0, len(r.t.Mappool))
+	for slot := range r.t.Mappool {
+		if slot != "TB" && !slices.Contains(r.picked, slot) && !slices.Contains(r.banned, slot) {
+			slots = append(slots, slot)
+		}
+	}
+	slices.Sort(slots)
+	return slots
+}
+
+func (r *Referee) winner() int {
+	for i, p := range r.points {
+		if p > r.t.BestOf / 2 {
+			return i
+		}
+	}
+	return -1
+}
+
+func (r *Referee) score() string {
+	return fmt.Sprintf(
+		"%v %v - %v %v",
+		r.t.Teams[0].Name,
+		r.points[0],
+		r.points[1],
+		r.t.Teams[1].Name,
+	)
+}
+
+func (r *Referee) stopTimer() {
+	if r.timer != nil {
+		r.timer.Stop()
+		r.timer = nil
+	}
+}
+
+func (b *Bot) startTournament(lobby string) {
+	r := b.referee
+	r.stopTimer()
+	*r = *NewReferee(r.t)
+	r.started = true
+
+	b.mp(lobby, "set", "2", "3")
+	for i, t := range r.t.Teams {
+		color := [2]string{"red", "blue"}[i]
+		for _, p := range slices.Concat([]string{t.Captain}, t.Players) {
+			if p != "" {
+				b.mp(lobby, "team", p, color)
+			}
+		}
+	}
+	b.conn.Send(
+		"PRIVMSG",
+		lobby,
+		fmt.Sprintf("%v vs %v, best of %v", r.t.Teams[0].Name, r.t.Teams[1].Name, r.t.BestOf),
+	)
+	b.advanceTournament(lobby)
+}
+
+func (b *Bot) advanceTournament(lobby string) {
+	r := b.referee
+
+	if w := r.winner(); w != -1 {
+		r.started = false
+		b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("%v wins! Final score: %v", r.t.Teams[w].Name, r.score()))
+		slog.Info("Tournament finished", "lobby", lobby, "score", r.score())
+		return
+	}
+
+	tied := r.points[0] == r.points[1] && r.points[0] + r.points[1] == r.t.BestOf - 1
+	if _, ok := r.t.Mappool["TB"]; ok && r.t.BestOf > 1 && tied {
+		b.conn.Send("PRIVMSG", lobby, "Tiebreaker!")
+		b.selectTournamentMap(lobby, "TB")
+		return
+	}
+
+	if r.step < len(r.t.Order) {
+		r.turn, r.action = r.t.Order[r.step].Team, r.t.Order[r.step].Action
+	} else {
+		r.turn, r.action = (r.lastPicker + 1) % 2, "pick"
+	}
+
+	slots := r.available()
+	if len(slots) == 0 {
+		r.started = false
+		b.conn.Send("PRIVMSG", lobby, "The mappool is exhausted. Final score:", r.score())
+		return
+	}
+
+	team := r.t.Teams[r.turn]
+	b.conn.Send(
+		"PRIVMSG",
+		lobby,
+		fmt.Sprintf(
+			"%v (%v), please !%v a map: %v",
+			team.Captain,
+			team.Name,
+			r.action,
+			strings.Join(slots, ", "),
+		),
+	)
+
+	if r.t.PickTime > 0 {
+		step := r.step
+		r.timer = b.clock.AfterFunc(time.Duration(r.t.PickTime) * time.Second, func(){
+			defer b.recoverEvent("tournament pick timer")
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if !r.started || r.step != step || r.current != "" {
+				return
+			}
+			logRejection("Ran out of time to " + r.action, lobby, team.Captain, "team", team.Name)
+			b.conn.Send(
+				"PRIVMSG",
+				lobby,
+				fmt.Sprintf("%v ran out of time, the %v is forfeited.", team.Name, r.action),
+			)
+			if r.action == "pick" {
+				r.lastPicker = r.turn
+			}
+			r.step++
+			r.timer = nil
+			b.advanceTournament(lobby)
+		})
+	}
+}
+
+func (b *Bot) selectTournamentMap(lobby, slot string) {
+	r := b.referee
+	r.current = slot
+	r.scores = [2]int{}
+
+	mods := slices.Clone(bracketMods[slot[:min(2, len(slot))]])
+	if r.t.NoFail && !slices.Contains(mods, "Freemod") {
+		mods = append(mods, "NF")
+	}
+	if len(mods) == 0 {
+		mods = []string{"None"}
+	}
+
+	b.mp(lobby, "map", r.t.Mappool[slot], "0")
+	b.mp(lobby, append([]any{"mods"}, toAnySlice(mods)...)...)
+	slog.Info("Selected " + slot, "lobby", lobby, "id", r.t.Mappool[slot])
+}
+
+func (b *Bot) onTournamentCommand(lobby, user, cmd string, args []string) {
+	r := b.referee
+	if !r.started || r.current != "" {
+		return
+	}
+
+	team := r.t.Teams[r.turn]
+	if !sameUser(user, team.Captain) {
+		return
+	}
+	if cmd != r.action {
+		b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("%v, it is your turn to !%v.", user, r.action))
+		return
+	}
+	if len(args) != 1 {
+		b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("Syntax: !%v <slot>", r.action))
+		return
+	}
+
+	slot := strings.ToUpper(args[0])
+	if !slices.Contains(r.available(), slot) {
+		b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("%v is not available.", slot))
+		return
+	}
+
+	r.stopTimer()
+	r.step++
+	if cmd == "ban" {
+		r.banned = append(r.banned, slot)
+		b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("%v banned %v", team.Name, slot))
+		b.advanceTournament(lobby)
+	} else {
+		r.picked = append(r.picked, slot)
+		r.lastPicker = r.turn
+		b.conn.Send("PRIVMSG", lobby, fmt.Sprintf("%v picked %v", team.Name, slot))
+		b.selectTournamentMap(lobby, slot)
+	}
+}
+
+func (b *Bot) onTournamentMatchFinished(lobby string) {
+	r := b.referee
+	if !r.started || r.current == "" {
+		return
+	}
+
+	if r.scores[0] == r.scores[1] {
+		b.conn.Send(
+			"PRIVMSG",
+			lobby,
+			fmt.Sprintf("The map is a tie (%v - %v), it will be replayed.", r.scores[0], r.scores[1]),
+		)
+		slog.Info("Replaying tied map " + r.current, "lobby", lobby, "score", r.scores[0])
+		b.selectTournamentMap(lobby, r.current)
+		return
+	}
+
+	w := 0
+	if r.scores[1] > r.scores[0] {
+		w = 1
+	}
+	r.points[w]++
+	r.current = ""
+
+	b.conn.Send(
+		"PRIVMSG",
+		lobby,
+		fmt.Sprintf(
+			"%v wins the map (%v - %v). %v",
+			r.t.Teams[w].Name,
+			r.scores[0],
+			r.scores[1],
+			r.score(),
+		),
+	)
+	b.advanceTournament(lobby)
+}
+
+func (b *Bot) tournamentStatus() string {
+	r := b.referee
+	msg := strings.Builder{}
+	msg.WriteString(r.score())
+	if len(r.picked) > 0 {
+		msg.WriteString(" | Picked: " + strings.Join(r.picked, ", "))
+	}
+	if len(r.banned) > 0 {
+		msg.WriteString(" | Banned: " + strings.Join(r.banned, ", "))
+	}
+	if !r.started {
+		msg.WriteString(" | Not started")
+	} else if r.current != "" {
+		msg.WriteString(" | Playing " + r.current)
+	} else {
+		msg.WriteString(fmt.Sprintf(" | %v to %v", r.t.Teams[r.turn].Name, r.action))
+	}
+	return msg.String()
+}
+
+func sameUser(a, b string) bool {
+	return strings.EqualFold(strings.ReplaceAll(a, " ", "_"), strings.ReplaceAll(b, " ", "_"))
+}
+
+func equalFoldFunc(target string) func(string)bool {
+	return func(s string)bool{ return strings.EqualFold(s, target) }
+}
+
+func toAnySlice[T any](s []T) []any {
+	out := make([]any, len(s), len(s))
+	for i, v := range s {
+		out[i] = v
+	}
+	return out
+}
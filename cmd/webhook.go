@@ -0,0 +1,252 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+	"bytes"
+	"slices"
+	"strconv"
+	"strings"
+	"net/url"
+	"net/http"
+	"log/slog"
+	"encoding/json"
+	"text/template"
+
+	"osubot"
+	"osubot/osu/irc"
+)
+
+type Notification struct {
+	Event string          `json:"event"`
+	Lobby string          `json:"lobby,omitempty"`
+	User string           `json:"user,omitempty"`
+	Time time.Time        `json:"time"`
+	Text string           `json:"text"`
+	Fields map[string]any `json:"fields,omitempty"`
+}
+
+type Result struct {
+	User string `json:"user"`
+	Score int   `json:"score"`
+	Passed bool `json:"passed"`
+}
+
+type Notifier struct {
+	irc.BaseDispatcher
+	hooks []*webhook
+	mu sync.Mutex
+	beatmap string
+	results []Result
+}
+
+type webhook struct {
+	url, host, format string
+	events []string
+	templates map[string]*template.Template
+	queue chan Notification
+	pending sync.WaitGroup
+}
+
+var defaultTemplates = map[string]string{
+	"room_created": "Created {{.Lobby}}",
+	"room_closed": "Closed {{.Lobby}}",
+	"player_joined": "{{.User}} joined {{.Lobby}}",
+	"player_left": "{{.User}} left {{.Lobby}}",
+	"map_picked": "Picked {{.Fields.beatmap}} https://osu.ppy.sh/b/{{.Fields.id}}",
+	"match_finished": "Finished {{.Fields.beatmap}}" +
+		"{{range .Fields.results}}\n{{.User}}: {{.Score}}{{if not .Passed}} (failed){{end}}{{end}}",
+	"crash": "{{if .Fields.fatal}}The bot has crashed{{else}}The bot has recovered from a crash{{end}}: {{.Fields.panic}}",
+	"reconnect": "Reconnected to {{.Lobby}}",
+}
+
+var webhookClient = &http.Client{ Timeout: 10 * time.Second }
+
+func NewNotifier(hooks []osubot.Webhook) (*Notifier, error) {
+	n := &Notifier{}
+	for i, h := range hooks {
+		w := &webhook{
+			url: h.URL,
+			format: h.Format,
+			events: h.Events,
+			templates: map[string]*template.Template{},
+			queue: make(chan Notification, 64),
+		}
+		if u, e := url.Parse(h.URL); e == nil {
+			w.host = u.Host
+		}
+		if w.format != "" && w.format != "json" && w.format != "discord" {
+			return nil, fmt.Errorf("webhooks[%v].format: unknown format %q", i, w.format)
+		}
+		for event, text := range defaultTemplates {
+			if t, ok := h.Templates[event]; ok {
+				text = t
+			}
+			t, e := template.New(event).Option("missingkey=zero").Parse(text)
+			if e != nil {
+				return nil, fmt.Errorf("webhooks[%v].templates.%v: %w", i, event, e)
+			}
+			w.templates[event] = t
+		}
+		go w.run()
+		n.hooks = append(n.hooks, w)
+	}
+	return n, nil
+}
+
+func (n *Notifier) Notify(event, lobby, user string, fields map[string]any) {
+	if n == nil {
+		return
+	}
+	for _, w := range n.hooks {
+		if len(w.events) > 0 && !slices.Contains(w.events, event) {
+			continue
+		}
+		nt := Notification{ Event: event, Lobby: lobby, User: user, Time: time.Now(), Fields: fields }
+		var sb strings.Builder
+		if e := w.templates[event].Execute(&sb, nt); e != nil {
+			slog.Warn("Failed to render the webhook template", "event", event, "error", e)
+			continue
+		}
+		nt.Text = sb.String()
+
+		w.pending.Add(1)
+		select {
+		case w.queue <- nt:
+		default:
+			w.pending.Done()
+			slog.Warn("Webhook queue is full, dropping the notification", "host", w.host, "event", event)
+		}
+	}
+}
+
+func (n *Notifier) Flush(timeout time.Duration) {
+	if n == nil {
+		return
+	}
+	done := make(chan struct{})
+	go func(){
+		for _, w := range n.hooks {
+			w.pending.Wait()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+	}
+}
+
+func (w *webhook) run() {
+	for nt := range w.queue {
+		delay := time.Second
+		for attempt := 1; ; attempt++ {
+			retryAfter, retry, e := w.send(nt)
+			if e == nil {
+				break
+			}
+			if !retry || attempt == 3 {
+				slog.Warn("Failed to send the webhook", "host", w.host, "event", nt.Event, "error", e)
+				break
+			}
+			time.Sleep(max(delay, retryAfter))
+			delay *= 2
+		}
+		w.pending.Done()
+	}
+}
+
+func (w *webhook) send(nt Notification) (retryAfter time.Duration, retry bool, e error) {
+	var body []byte
+	if w.format == "discord" {
+		body, e = json.Marshal(discordPayload(nt))
+	} else {
+		body, e = json.Marshal(nt)
+	}
+	if e != nil {
+		return
+	}
+
+	rp, e := webhookClient.Post(w.url, "application/json", bytes.NewReader(body))
+	if e != nil {
+		return 0, true, e
+	}
+	defer rp.Body.Close()
+
+	if rp.StatusCode >= 300 {
+		if s, err := strconv.ParseFloat(rp.Header.Get("Retry-After"), 64); err == nil {
+			retryAfter = time.Duration(s * float64(time.Second))
+		}
+		retry = rp.StatusCode < 400 || rp.StatusCode >= 500 || rp.StatusCode == http.StatusTooManyRequests
+		e = fmt.Errorf("%v", rp.Status)
+	}
+	return
+}
+
+func discordPayload(nt Notification) map[string]any {
+	colors := map[string]int{
+		"room_created": 0x57f287,
+		"room_closed": 0x99aab5,
+		"match_finished": 0x5865f2,
+		"crash": 0xed4245,
+		"reconnect": 0xfee75c,
+	}
+	title := strings.ReplaceAll(nt.Event, "_", " ")
+	if nt.Lobby != "" {
+		title += " · " + nt.Lobby
+	}
+	return map[string]any{
+		"embeds": []map[string]any{{
+			"title": strings.ToUpper(title[:1]) + title[1:],
+			"description": nt.Text,
+			"color": colors[nt.Event],
+			"timestamp": nt.Time.Format(time.RFC3339),
+		}},
+	}
+}
+
+func (n *Notifier) OnClosed(lobby string) {
+	n.Notify("room_closed", lobby, "", nil)
+}
+
+func (n *Notifier) OnUserJoined(lobby, user string) {
+	n.Notify("player_joined", lobby, user, nil)
+}
+
+func (n *Notifier) OnUserLeft(lobby, user string) {
+	n.Notify("player_left", lobby, user, nil)
+}
+
+func (n *Notifier) MapPicked(lobby, beatmap string, id int) {
+	if n == nil {
+		return
+	}
+	n.mu.Lock()
+	n.beatmap = beatmap
+	n.mu.Unlock()
+	n.Notify("map_picked", lobby, "", map[string]any{ "beatmap": beatmap, "id": id })
+}
+
+func (n *Notifier) OnMatchStarted(lobby string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.results = nil
+}
+
+func (n *Notifier) OnPlayerFinished(lobby, user string, score int, passed bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.results = append(n.results, Result{ User: user, Score: score, Passed: passed })
+}
+
+func (n *Notifier) OnMatchFinished(lobby string) {
+	n.mu.Lock()
+	results := slices.Clone(n.results)
+	beatmap := n.beatmap
+	n.results = nil
+	n.mu.Unlock()
+
+	slices.SortStableFunc(results, func(a, b Result) int { return b.Score - a.Score })
+	n.Notify("match_finished", lobby, "", map[string]any{ "beatmap": beatmap, "results": results })
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"sync"
+	"time"
+	"testing"
+	"net/http"
+	"encoding/json"
+	"net/http/httptest"
+
+	"osubot"
+)
+
+type webhookServer struct {
+	*httptest.Server
+	mu sync.Mutex
+	statuses []int
+	received []Notification
+}
+
+func newWebhookServer(statuses ...int) *webhookServer {
+	s := &webhookServer{ statuses: statuses }
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request){
+		var nt Notification
+		json.NewDecoder(r.Body).Decode(&nt)
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.received = append(s.received, nt)
+		status := http.StatusNoContent
+		if len(s.statuses) > 0 {
+			status, s.statuses = s.statuses[0], s.statuses[1:]
+		}
+		w.WriteHeader(status)
+	}))
+	return s
+}
+
+func (s *webhookServer) notifications() []Notification {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
+
+func newTestNotifier(t *testing.T, hooks ...osubot.Webhook) *Notifier {
+	n, e := NewNotifier(hooks)
+	if e != nil {
+		t.Fatal(e)
+	}
+	return n
+}
+
+func TestWebhookSendsJSON(t *testing.T) {
+	s := newWebhookServer()
+	defer s.Close()
+	n := newTestNotifier(t, osubot.Webhook{ URL: s.URL })
+
+	n.Notify("player_joined", "#mp_1", "alice", nil)
+	n.Flush(5 * time.Second)
+
+	got := s.notifications()
+	if len(got) != 1 {
+		t.Fatalf("got %v requests, want 1", len(got))
+	}
+	if got[0].Event != "player_joined" || got[0].User != "alice" || got[0].Text != "alice joined #mp_1" {
+		t.Errorf("unexpected notification %+v", got[0])
+	}
+}
+
+func TestWebhookFiltersEvents(t *testing.T) {
+	s := newWebhookServer()
+	defer s.Close()
+	n := newTestNotifier(t, osubot.Webhook{ URL: s.URL, Events: []string{"match_finished"} })
+
+	n.Notify("player_joined", "#mp_1", "alice", nil)
+	n.MapPicked("#mp_1", "Artist - Title [Hard]", 123)
+	n.OnPlayerFinished("#mp_1", "alice", 1000, true)
+	n.OnMatchFinished("#mp_1")
+	n.Flush(5 * time.Second)
+
+	got := s.notifications()
+	if len(got) != 1 || got[0].Event != "match_finished" {
+		t.Fatalf("got %+v, want a single match_finished", got)
+	}
+	if got[0].Fields["beatmap"] != "Artist - Title [Hard]" {
+		t.Errorf("match_finished has beatmap %v", got[0].Fields["beatmap"])
+	}
+}
+
+func TestWebhookRetriesServerErrors(t *testing.T) {
+	s := newWebhookServer(http.StatusInternalServerError)
+	defer s.Close()
+	n := newTestNotifier(t, osubot.Webhook{ URL: s.URL })
+
+	n.Notify("room_created", "#mp_1", "", nil)
+	n.Flush(5 * time.Second)
+
+	if got := len(s.notifications()); got != 2 {
+		t.Errorf("got %v requests, want 2", got)
+	}
+}
+
+func TestWebhookDoesNotRetryClientErrors(t *testing.T) {
+	s := newWebhookServer(http.StatusBadRequest, http.StatusBadRequest)
+	defer s.Close()
+	n := newTestNotifier(t, osubot.Webhook{ URL: s.URL })
+
+	n.Notify("room_created", "#mp_1", "", nil)
+	n.Flush(5 * time.Second)
+
+	if got := len(s.notifications()); got != 1 {
+		t.Errorf("got %v requests, want 1", got)
+	}
+}
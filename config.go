@@ -2,21 +2,59 @@ package osubot
 
 import (
 	"os"
+	"fmt"
+	"net"
+	"bytes"
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"net/url"
+	"path/filepath"
+	"log/slog"
 	"encoding/json"
+	"text/template"
+)
+
+const ConfigVersion = 2
+
+var (
+	TeamModes = []string{ "HeadToHead", "TagCoop", "TeamVs", "TagTeamVs" }
+	ScoreModes = []string{ "Score", "Accuracy", "Combo", "ScoreV2" }
+	QueuePolicies = []string{ "fifo", "fair" }
+	WebhookEvents = []string{
+		"room_created",
+		"room_closed",
+		"player_joined",
+		"player_left",
+		"map_picked",
+		"match_finished",
+		"crash",
+		"reconnect",
+	}
 )
 
 type Config struct {
+	Version int `json:"version"`
 	IRC struct {
 		Addr string       `json:"address"`
 		User string       `json:"username"`
 		Pass string       `json:"password"`
 		RateLimit float32 `json:"rate_limit"`
+		TLS bool          `json:"tls"`
+		ConnectTimeout int `json:"connect_timeout"`
+		ReadTimeout int    `json:"read_timeout"`
+		KeepAlive int      `json:"keep_alive"`
+		Proxy string       `json:"proxy"`
+		PingInterval int   `json:"ping_interval"`
+		PingTimeout int    `json:"ping_timeout"`
 	} `json:"irc"`
 	API struct {
 		Addr string   `json:"address"`
 		ID string     `json:"id"`
 		Secret string `json:"secret"`
 	} `json:"api"`
+	Secrets string `json:"secrets"`
 	HR struct {
 		Enabled bool    `json:"enabled"`
 		PrintQueue bool `json:"print_queue"`
@@ -24,7 +62,118 @@ type Config struct {
 	DC struct {
 		Enabled bool `json:"enabled"`
 		Range [2]float32 `json:"range"`
-	} `json:"diffuclty_constraint"`
+	} `json:"difficulty_constraint"`
+	Moderation struct {
+		Enabled bool        `json:"enabled"`
+		FloodMessages int   `json:"flood_messages"`
+		FloodSeconds int    `json:"flood_seconds"`
+		Repeats int         `json:"repeats"`
+		BlockLinks bool     `json:"block_links"`
+		Blocklist []string  `json:"blocklist"`
+		BanMinutes int      `json:"ban_minutes"`
+		StrikeMinutes int   `json:"strike_minutes"`
+	} `json:"moderation"`
+	Room struct {
+		Name string       `json:"name"`
+		Password string   `json:"password"`
+		Size int          `json:"size"`
+		TeamMode string   `json:"team_mode"`
+		ScoreMode string  `json:"score_mode"`
+		Mods []string     `json:"mods"`
+		Invite []string   `json:"invite"`
+		Beatmap int       `json:"beatmap"`
+		QueuePolicy string `json:"queue_policy"`
+		BoostMinutes int   `json:"boost_minutes"`
+		GraceMinutes int   `json:"grace_minutes"`
+	} `json:"room"`
+	Requests struct {
+		Enabled bool       `json:"enabled"`
+		MaxPerPlayer int   `json:"max_per_player"`
+		MaxLength int      `json:"max_length"`
+	} `json:"requests"`
+	Recommendations struct {
+		Enabled bool       `json:"enabled"`
+		Auto bool          `json:"auto"`
+		Width float32      `json:"width"`
+		Hysteresis float32 `json:"hysteresis"`
+	} `json:"recommendations"`
+	Commands struct {
+		Private []string `json:"private"`
+	} `json:"commands"`
+	Webhooks []Webhook `json:"webhooks"`
+	Overrides Overrides `json:"overrides"`
+	Tournament string `json:"tournament"`
+	HTTP struct {
+		Enabled bool `json:"enabled"`
+		Addr string  `json:"address"`
+		Token string `json:"token"`
+	} `json:"http"`
+	Metrics struct {
+		Enabled bool `json:"enabled"`
+		Addr string  `json:"address"`
+	} `json:"metrics"`
+	Record string `json:"record"`
+	Log struct {
+		Level string  `json:"level"`
+		Format string `json:"format"`
+		File string   `json:"file"`
+		MaxSize int   `json:"max_size"`
+		MaxFiles int  `json:"max_files"`
+		Events string `json:"events"`
+	} `json:"log"`
+	migrated bool
+}
+
+type Webhook struct {
+	URL string                   `json:"url"`
+	Format string                `json:"format"`
+	Events []string              `json:"events"`
+	Templates map[string]string  `json:"templates"`
+}
+
+type Overrides struct {
+	HostRotation *bool               `json:"host_rotation,omitempty"`
+	PrintQueue *bool                 `json:"print_queue,omitempty"`
+	DifficultyConstraint *bool       `json:"difficulty_constraint,omitempty"`
+	DifficultyRange *[2]float32      `json:"difficulty_range,omitempty"`
+}
+
+type FieldError struct {
+	Field, Msg string
+}
+
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Msg
+}
+
+var migrations = map[int]func(map[string]json.RawMessage){
+	1: func(raw map[string]json.RawMessage) {
+		if v, ok := raw["diffuclty_constraint"]; ok {
+			raw["difficulty_constraint"] = v
+			delete(raw, "diffuclty_constraint")
+		}
+	},
+}
+
+func DefaultConfig(user, pass, id, secret string) (c Config) {
+	c.Version = ConfigVersion
+	c.IRC.Addr = "irc.ppy.sh:6667"
+	c.IRC.User = user
+	c.IRC.Pass = pass
+	c.IRC.RateLimit = 4
+	c.API.Addr = "https://osu.ppy.sh"
+	c.API.ID = id
+	c.API.Secret = secret
+	c.HR.Enabled = true
+	c.DC.Range[1] = 10
+	c.Room.Name = "{{.User}}'s game"
+	c.Room.Size = 8
+	c.Room.Mods = []string{ "Freemod" }
+	c.Room.Invite = []string{ user }
+	c.Log.Level = "info"
+	c.Log.Format = "text"
+	c.Log.Events = "events.jsonl"
+	return
 }
 
 func (c *Config) LoadFile(path string) error {
@@ -33,15 +182,246 @@ func (c *Config) LoadFile(path string) error {
 		return e
 	}
 	if e = json.Unmarshal(b, c); e != nil {
+		return fmt.Errorf("%v: %w", path, e)
+	}
+	return nil
+}
+
+func (c *Config) UnmarshalJSON(b []byte) error {
+	var raw map[string]json.RawMessage
+	if e := json.Unmarshal(b, &raw); e != nil {
 		return e
 	}
+	if raw == nil {
+		return errors.New("the config must be a JSON object")
+	}
+
+	version := 1
+	if v, ok := raw["version"]; ok {
+		if e := json.Unmarshal(v, &version); e != nil {
+			return FieldError{ "version", "must be a number" }
+		}
+	}
+	migrated := version < ConfigVersion
+	if version > ConfigVersion {
+		return FieldError{ "version", fmt.Sprintf("%v is newer than the supported version %v", version, ConfigVersion) }
+	}
+	for ; version < ConfigVersion; version++ {
+		if m, ok := migrations[version]; ok {
+			m(raw)
+		}
+	}
+	raw["version"] = json.RawMessage(fmt.Sprint(ConfigVersion))
+
+	b, e := json.Marshal(raw)
+	if e != nil {
+		return e
+	}
+	type plain Config
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.DisallowUnknownFields()
+	if e = d.Decode((*plain)(c)); e != nil {
+		return e
+	}
+	c.migrated = migrated
 	return nil
 }
 
+func (c Config) Migrated() bool {
+	return c.migrated
+}
+
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, msg string, args ...any) {
+		if !ok {
+			errs = append(errs, FieldError{ field, fmt.Sprintf(msg, args...) })
+		}
+	}
+	isAddr := func(addr string) bool {
+		_, _, e := net.SplitHostPort(addr)
+		return e == nil
+	}
+	isURL := func(s string, schemes ...string) bool {
+		u, e := url.Parse(s)
+		return e == nil && u.Host != "" && slices.Contains(schemes, u.Scheme)
+	}
+
+	check(isAddr(c.IRC.Addr), "irc.address", "must be host:port, got %q", c.IRC.Addr)
+	check(c.IRC.User != "", "irc.username", "must not be empty")
+	check(c.IRC.RateLimit > 0, "irc.rate_limit", "must be greater than 0, got %v", c.IRC.RateLimit)
+	check(c.IRC.ConnectTimeout >= 0, "irc.connect_timeout", "must not be negative")
+	check(c.IRC.ReadTimeout >= 0, "irc.read_timeout", "must not be negative")
+	check(c.IRC.KeepAlive >= 0, "irc.keep_alive", "must not be negative")
+	check(c.IRC.PingTimeout >= 0, "irc.ping_timeout", "must not be negative")
+	if c.IRC.Proxy != "" {
+		check(
+			isURL(c.IRC.Proxy, "socks5", "socks5h", "http"),
+			"irc.proxy",
+			"must be a socks5:// or http:// URL, got %q",
+			c.IRC.Proxy,
+		)
+	}
+
+	check(isURL(c.API.Addr, "http", "https"), "api.address", "must be an http(s) URL, got %q", c.API.Addr)
+
+	r := c.DC.Range
+	check(r[0] >= 0, "difficulty_constraint.range[0]", "must not be negative, got %v", r[0])
+	check(r[0] <= r[1], "difficulty_constraint.range", "minimum %v is greater than maximum %v", r[0], r[1])
+
+	if _, e := template.New("").Parse(c.Room.Name); e != nil {
+		check(false, "room.name", "%v", e)
+	}
+	check(c.Room.Size >= 0 && c.Room.Size <= 16, "room.size", "must be between 1 and 16 or 0 for the default, got %v", c.Room.Size)
+	if c.Room.TeamMode != "" {
+		check(
+			slices.Contains(TeamModes, c.Room.TeamMode),
+			"room.team_mode",
+			"must be one of %v, got %q",
+			strings.Join(TeamModes, ", "),
+			c.Room.TeamMode,
+		)
+	}
+	if c.Room.ScoreMode != "" {
+		check(
+			slices.Contains(ScoreModes, c.Room.ScoreMode),
+			"room.score_mode",
+			"must be one of %v, got %q",
+			strings.Join(ScoreModes, ", "),
+			c.Room.ScoreMode,
+		)
+	}
+	check(c.Room.Beatmap >= 0, "room.beatmap", "must not be negative")
+	if c.Room.QueuePolicy != "" {
+		check(
+			slices.Contains(QueuePolicies, c.Room.QueuePolicy),
+			"room.queue_policy",
+			"must be one of %v, got %q",
+			strings.Join(QueuePolicies, ", "),
+			c.Room.QueuePolicy,
+		)
+	}
+	check(c.Room.BoostMinutes >= 0, "room.boost_minutes", "must not be negative")
+	check(c.Room.GraceMinutes >= 0, "room.grace_minutes", "must not be negative")
+
+	check(c.Requests.MaxPerPlayer >= 0, "requests.max_per_player", "must not be negative")
+	check(c.Requests.MaxLength >= 0, "requests.max_length", "must not be negative")
+
+	check(c.Recommendations.Width >= 0, "recommendations.width", "must not be negative")
+	check(c.Recommendations.Hysteresis >= 0, "recommendations.hysteresis", "must not be negative")
+
+	check(c.Moderation.FloodMessages >= 0, "moderation.flood_messages", "must not be negative")
+	check(c.Moderation.FloodSeconds >= 0, "moderation.flood_seconds", "must not be negative")
+	check(c.Moderation.Repeats == 0 || c.Moderation.Repeats >= 2, "moderation.repeats", "must be at least 2 or 0 to disable, got %v", c.Moderation.Repeats)
+	check(c.Moderation.BanMinutes >= 0, "moderation.ban_minutes", "must not be negative")
+	check(c.Moderation.StrikeMinutes >= 0, "moderation.strike_minutes", "must not be negative")
+	for i, w := range c.Moderation.Blocklist {
+		if len(w) > 2 && strings.HasPrefix(w, "/") && strings.HasSuffix(w, "/") {
+			if _, e := regexp.Compile(w[1:len(w)-1]); e != nil {
+				check(false, fmt.Sprintf("moderation.blocklist[%v]", i), "%v", e)
+			}
+		}
+	}
+
+	for i, h := range c.Webhooks {
+		field := fmt.Sprintf("webhooks[%v]", i)
+		check(isURL(h.URL, "http", "https"), field + ".url", "must be an http(s) URL, got %q", h.URL)
+		check(
+			h.Format == "" || h.Format == "json" || h.Format == "discord",
+			field + ".format",
+			"must be json or discord, got %q",
+			h.Format,
+		)
+		for j, event := range h.Events {
+			check(slices.Contains(WebhookEvents, event), fmt.Sprintf("%v.events[%v]", field, j), "unknown event %q", event)
+		}
+		for event, text := range h.Templates {
+			check(slices.Contains(WebhookEvents, event), field + ".templates." + event, "unknown event")
+			if _, e := template.New("").Parse(text); e != nil {
+				check(false, field + ".templates." + event, "%v", e)
+			}
+		}
+	}
+
+	if c.HTTP.Enabled && c.HTTP.Addr != "" {
+		check(isAddr(c.HTTP.Addr), "http.address", "must be host:port, got %q", c.HTTP.Addr)
+	}
+	if c.Metrics.Enabled && c.Metrics.Addr != "" {
+		check(isAddr(c.Metrics.Addr), "metrics.address", "must be host:port, got %q", c.Metrics.Addr)
+	}
+
+	var level slog.Level
+	if c.Log.Level != "" {
+		check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level", "unknown level %q", c.Log.Level)
+	}
+	check(c.Log.Format == "" || c.Log.Format == "text" || c.Log.Format == "json", "log.format", "must be text or json")
+	check(c.Log.MaxSize >= 0, "log.max_size", "must not be negative")
+	check(c.Log.MaxFiles >= 0, "log.max_files", "must not be negative")
+
+	return errors.Join(errs...)
+}
+
+var EnvVars = []string{
+	"OSUBOT_IRC_USER",
+	"OSUBOT_IRC_PASSWORD",
+	"OSUBOT_API_ID",
+	"OSUBOT_API_SECRET",
+	"OSUBOT_HTTP_TOKEN",
+}
+
+func (c *Config) LoadEnv() {
+	fields := []*string{ &c.IRC.User, &c.IRC.Pass, &c.API.ID, &c.API.Secret, &c.HTTP.Token }
+	for i, name := range EnvVars {
+		if v, ok := os.LookupEnv(name); ok {
+			*fields[i] = v
+		}
+	}
+}
+
+func (c Config) WithOverrides() Config {
+	o := c.Overrides
+	if o.HostRotation != nil {
+		c.HR.Enabled = *o.HostRotation
+	}
+	if o.PrintQueue != nil {
+		c.HR.PrintQueue = *o.PrintQueue
+	}
+	if o.DifficultyConstraint != nil {
+		c.DC.Enabled = *o.DifficultyConstraint
+	}
+	if o.DifficultyRange != nil {
+		c.DC.Range = *o.DifficultyRange
+	}
+	return c
+}
+
 func (c Config) SaveFile(path string) error {
+	c.Version = ConfigVersion
 	b, e := json.MarshalIndent(c, "", "\t")
 	if e != nil {
 		return e
 	}
-	return os.WriteFile(path, b, 0666)
+	return writeFileAtomic(path, b, 0600)
+}
+
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, e := os.CreateTemp(filepath.Dir(path), filepath.Base(path) + ".*.tmp")
+	if e != nil {
+		return e
+	}
+	defer os.Remove(f.Name())
+
+	if _, e = f.Write(data); e == nil {
+		e = f.Sync()
+	}
+	if e2 := f.Close(); e == nil {
+		e = e2
+	}
+	if e == nil {
+		e = os.Chmod(f.Name(), perm)
+	}
+	if e != nil {
+		return e
+	}
+	return os.Rename(f.Name(), path)
 }
@@ -0,0 +1,55 @@
+package osubot
+
+import (
+	"strings"
+	"testing"
+	"encoding/json"
+)
+
+func TestConfigMigratesDifficultyConstraint(t *testing.T) {
+	var c Config
+	e := json.Unmarshal([]byte(`{"diffuclty_constraint": {"enabled": true, "range": [2, 5]}}`), &c)
+	if e != nil {
+		t.Fatal(e)
+	}
+	if !c.Migrated() || c.Version != ConfigVersion {
+		t.Errorf("got version %v, migrated %v", c.Version, c.Migrated())
+	}
+	if !c.DC.Enabled || c.DC.Range != [2]float32{ 2, 5 } {
+		t.Errorf("difficulty constraint was not migrated: %+v", c.DC)
+	}
+}
+
+func TestConfigRejectsUnknownFields(t *testing.T) {
+	var c Config
+	e := json.Unmarshal([]byte(`{"version": 2, "typo": 1}`), &c)
+	if e == nil || !strings.Contains(e.Error(), "typo") {
+		t.Errorf("got %v, want an unknown field error", e)
+	}
+}
+
+func TestConfigRejectsNull(t *testing.T) {
+	var c Config
+	if e := json.Unmarshal([]byte(`null`), &c); e == nil {
+		t.Error("null was accepted")
+	}
+}
+
+func TestConfigRejectsNewerVersion(t *testing.T) {
+	var c Config
+	if e := json.Unmarshal([]byte(`{"version": 99}`), &c); e == nil {
+		t.Error("version 99 was accepted")
+	}
+}
+
+func TestValidateReversedRange(t *testing.T) {
+	c := DefaultConfig("user", "pass", "1", "secret")
+	if e := c.Validate(); e != nil {
+		t.Fatalf("default config is invalid: %v", e)
+	}
+	c.DC.Range = [2]float32{ 7, 3 }
+	e := c.Validate()
+	if e == nil || !strings.Contains(e.Error(), "difficulty_constraint.range: minimum 7 is greater than maximum 3") {
+		t.Errorf("got %v", e)
+	}
+}
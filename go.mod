@@ -2,4 +2,10 @@ module osubot
 
 go 1.25.5
 
-require github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510 // indirect
+require (
+	github.com/google/shlex v0.0.0-20191202100458-e7afc7fbc510
+	golang.org/x/net v0.47.0
+	golang.org/x/term v0.37.0
+)
+
+require golang.org/x/sys v0.38.0 // indirect
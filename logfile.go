@@ -0,0 +1,69 @@
+package osubot
+
+import (
+	"os"
+	"fmt"
+	"sync"
+)
+
+type RotatingFile struct {
+	mu sync.Mutex
+	path string
+	maxSize int64
+	maxFiles int
+	file *os.File
+	size int64
+}
+
+func OpenRotatingFile(path string, maxSize int64, maxFiles int) (*RotatingFile, error) {
+	f := &RotatingFile{ path: path, maxSize: maxSize, maxFiles: max(1, maxFiles) }
+	if e := f.open(); e != nil {
+		return nil, e
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.maxSize > 0 && f.size > 0 && f.size + int64(len(p)) > f.maxSize {
+		if e := f.rotate(); e != nil {
+			return 0, e
+		}
+	}
+
+	n, e := f.file.Write(p)
+	f.size += int64(n)
+	return n, e
+}
+
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+func (f *RotatingFile) open() error {
+	file, e := os.OpenFile(f.path, os.O_WRONLY | os.O_APPEND | os.O_CREATE, 0644)
+	if e != nil {
+		return e
+	}
+	info, e := file.Stat()
+	if e != nil {
+		file.Close()
+		return e
+	}
+	f.file, f.size = file, info.Size()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	os.Remove(fmt.Sprintf("%v.%v", f.path, f.maxFiles))
+	for i := f.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%v.%v", f.path, i), fmt.Sprintf("%v.%v", f.path, i + 1))
+	}
+	os.Rename(f.path, f.path + ".1")
+	return f.open()
+}
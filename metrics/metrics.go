@@ -0,0 +1,230 @@
+package metrics
+
+import (
+	"io"
+	"fmt"
+	"math"
+	"sync"
+	"slices"
+	"strings"
+	"net/http"
+	"sync/atomic"
+)
+
+type Counter struct {
+	bits atomic.Uint64
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Add(v float64) {
+	for {
+		old := c.bits.Load()
+		if c.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old) + v)) {
+			return
+		}
+	}
+}
+
+func (c *Counter) Value() float64 {
+	return math.Float64frombits(c.bits.Load())
+}
+
+type Gauge struct {
+	Counter
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+type Histogram struct {
+	mu sync.Mutex
+	buckets []float64
+	counts []uint64
+	sum float64
+	count uint64
+}
+
+var DefBuckets = []float64{ .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10 }
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+type metric interface {
+	write(w io.Writer, name, labels string)
+}
+
+func (c *Counter) write(w io.Writer, name, labels string) {
+	fmt.Fprintf(w, "%v%v %v\n", name, labels, c.Value())
+}
+
+func (h *Histogram) write(w io.Writer, name, labels string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.buckets {
+		fmt.Fprintf(w, "%v_bucket%v %v\n", name, joinLabels(labels, fmt.Sprintf("le=\"%v\"", b)), h.counts[i])
+	}
+	fmt.Fprintf(w, "%v_bucket%v %v\n", name, joinLabels(labels, "le=\"+Inf\""), h.count)
+	fmt.Fprintf(w, "%v_sum%v %v\n", name, labels, h.sum)
+	fmt.Fprintf(w, "%v_count%v %v\n", name, labels, h.count)
+}
+
+type family struct {
+	name, help, kind string
+	labels []string
+	mu sync.Mutex
+	children map[string]metric
+	new func() metric
+}
+
+func (f *family) with(values ...string) metric {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %v expects %v label values, got %v", f.name, len(f.labels), len(values)))
+	}
+
+	pairs := make([]string, len(values), len(values))
+	for i, v := range values {
+		pairs[i] = fmt.Sprintf("%v=%q", f.labels[i], v)
+	}
+	key := ""
+	if len(pairs) > 0 {
+		key = "{" + strings.Join(pairs, ",") + "}"
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m, ok := f.children[key]
+	if !ok {
+		m = f.new()
+		f.children[key] = m
+	}
+	return m
+}
+
+func (f *family) write(w io.Writer) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %v %v\n# TYPE %v %v\n", f.name, f.help, f.name, f.kind)
+	keys := make([]string, 0, len(f.children))
+	for k := range f.children {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		f.children[k].write(w, f.name, k)
+	}
+}
+
+type Registry struct {
+	mu sync.Mutex
+	families []*family
+}
+
+var Default = &Registry{}
+
+func (r *Registry) register(name, help, kind string, labels []string, new func() metric) *family {
+	f := &family{
+		name: name,
+		help: help,
+		kind: kind,
+		labels: labels,
+		children: map[string]metric{},
+		new: new,
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.families = append(r.families, f)
+	return f
+}
+
+func (r *Registry) Write(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.families {
+		f.write(w)
+	}
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, rq *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+type CounterVec struct {
+	f *family
+}
+
+func (v CounterVec) With(values ...string) *Counter {
+	return v.f.with(values...).(*Counter)
+}
+
+type GaugeVec struct {
+	f *family
+}
+
+func (v GaugeVec) With(values ...string) *Gauge {
+	return v.f.with(values...).(*Gauge)
+}
+
+type HistogramVec struct {
+	f *family
+}
+
+func (v HistogramVec) With(values ...string) *Histogram {
+	return v.f.with(values...).(*Histogram)
+}
+
+func NewCounter(name, help string) *Counter {
+	return NewCounterVec(name, help).With()
+}
+
+func NewCounterVec(name, help string, labels ...string) CounterVec {
+	return CounterVec{ Default.register(name, help, "counter", labels, func() metric { return &Counter{} }) }
+}
+
+func NewGauge(name, help string) *Gauge {
+	return GaugeVec{ Default.register(name, help, "gauge", nil, func() metric { return &Gauge{} }) }.With()
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return NewHistogramVec(name, help, buckets).With()
+}
+
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) HistogramVec {
+	return HistogramVec{
+		Default.register(name, help, "histogram", labels, func() metric {
+			return &Histogram{ buckets: buckets, counts: make([]uint64, len(buckets), len(buckets)) }
+		}),
+	}
+}
+
+func ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", Default.Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+func joinLabels(labels, extra string) string {
+	if labels == "" {
+		return "{" + extra + "}"
+	}
+	return labels[:len(labels)-1] + "," + extra + "}"
+}
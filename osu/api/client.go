@@ -5,10 +5,16 @@ import (
 	"fmt"
 	"time"
 	"sync"
+	"errors"
+	"slices"
+	"strconv"
 	"strings"
 	"context"
+	"net/url"
 	"net/http"
 	"encoding/json"
+
+	"osubot/metrics"
 )
 
 type Client struct {
@@ -23,38 +29,85 @@ func NewClient(addr, id, secret string) *Client {
 }
 
 func (c *Client) GetUserByName(ctx context.Context, name string) (u User, e error) {
-	e = c.do(ctx, &u, "GET", fmt.Sprintf("/api/v2/users/@%v", name))
+	e = c.do(ctx, &u, "user", "GET", fmt.Sprintf("/api/v2/users/@%v", name))
 	return
 }
 
 func (c *Client) GetBeatmap(ctx context.Context, id int) (b Beatmap, e error) {
-	e = c.do(ctx, &b, "GET", fmt.Sprintf("/api/v2/beatmaps/%v", id))
+	e = c.do(ctx, &b, "beatmap", "GET", fmt.Sprintf("/api/v2/beatmaps/%v", id))
 	return
 }
 
 func (c *Client) GetUserScore(ctx context.Context, userID int, beatmapID int) (s BeatmapUserScore, e error) {
-	e = c.do(ctx, &s, "GET", fmt.Sprintf("/api/v2/beatmaps/%v/scores/users/%v", beatmapID, userID))
+	e = c.do(ctx, &s, "user_score", "GET", fmt.Sprintf("/api/v2/beatmaps/%v/scores/users/%v", beatmapID, userID))
+	return
+}
+
+func (c *Client) GetUserBestScores(ctx context.Context, userID int, mode Mode, limit int) (s []Score, e error) {
+	e = c.do(ctx, &s, "user_best", "GET", fmt.Sprintf("/api/v2/users/%v/scores/best?mode=%v&limit=%v", userID, mode, limit))
+	return
+}
+
+func (c *Client) SearchBeatmapSets(ctx context.Context, q SearchQuery) (r SearchResult, e error) {
+	terms := []string{}
+	if q.Query != "" {
+		terms = append(terms, q.Query)
+	}
+	if q.MinStars > 0 {
+		terms = append(terms, fmt.Sprintf("stars>=%v", q.MinStars))
+	}
+	if q.MaxStars > 0 {
+		terms = append(terms, fmt.Sprintf("stars<=%v", q.MaxStars))
+	}
+	if q.MinLength > 0 {
+		terms = append(terms, fmt.Sprintf("length>=%v", q.MinLength))
+	}
+	if q.MaxLength > 0 {
+		terms = append(terms, fmt.Sprintf("length<=%v", q.MaxLength))
+	}
+
+	params := url.Values{}
+	params.Set("q", strings.Join(terms, " "))
+	if i := slices.Index(modes, q.Mode); i != -1 {
+		params.Set("m", strconv.Itoa(i))
+	}
+	if q.Status != "" {
+		params.Set("s", q.Status)
+	}
+	e = c.do(ctx, &r, "search", "GET", "/api/v2/beatmapsets/search?" + params.Encode())
 	return
 }
 
+func (c *Client) SetTransport(t http.RoundTripper) {
+	c.httpClient.Transport = t
+}
+
 func (c *Client) Token() Token {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	return c.token
 }
 
-func (c *Client) do(ctx context.Context, response any, method, endpoint string) error {
-	return c.doWithContent(ctx, response, "application/json", "", method, endpoint)
+func (c *Client) do(ctx context.Context, response any, name, method, endpoint string) error {
+	return c.doWithContent(ctx, response, name, "application/json", "", method, endpoint)
 }
 
 func (c *Client) doWithContent(
 	ctx context.Context,
 	response any,
+	name,
 	contentType,
 	content,
 	method,
 	endpoint string,
 ) (e error) {
+	defer func(t time.Time){
+		requestDuration.With(name).Observe(time.Since(t).Seconds())
+		if e != nil {
+			requestErrors.With(name).Inc()
+		}
+	}(time.Now())
+
 	var t Token
 	if t, e = c.ensureToken(ctx); e != nil {
 		return
@@ -78,7 +131,7 @@ func (c *Client) doWithContent(
 	defer rp.Body.Close()
 
 	if rp.StatusCode != 200 {
-		e = fmt.Errorf(rp.Status)
+		e = errors.New(rp.Status)
 		return
 	}
 
@@ -89,10 +142,7 @@ func (c *Client) doWithContent(
 	}
 
 	var errRp errorResponse
-	if e = json.Unmarshal(data, &errRp); e != nil {
-		return
-	}
-	if errRp.Error != "" {
+	if json.Unmarshal(data, &errRp) == nil && errRp.Error != "" {
 		e = fmt.Errorf("%v: %v", errRp.Error, errRp.ErrorDescription)
 		return
 	}
@@ -100,7 +150,7 @@ func (c *Client) doWithContent(
 	return json.Unmarshal(data, response)
 }
 
-func (c *Client) ensureToken(ctx context.Context) (Token, error) {
+func (c *Client) ensureToken(ctx context.Context) (_ Token, e error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
@@ -108,6 +158,14 @@ func (c *Client) ensureToken(ctx context.Context) (Token, error) {
 		return c.token, nil
 	}
 
+	tokenRefreshes.Inc()
+	defer func(t time.Time){
+		requestDuration.With("token").Observe(time.Since(t).Seconds())
+		if e != nil {
+			requestErrors.With("token").Inc()
+		}
+	}(time.Now())
+
 	content := fmt.Sprintf(
 		"client_id=%v&client_secret=%v&grant_type=client_credentials&scope=public",
 		c.id,
@@ -133,7 +191,7 @@ func (c *Client) ensureToken(ctx context.Context) (Token, error) {
 	defer rp.Body.Close()
 
 	if rp.StatusCode != 200 {
-		return Token{}, fmt.Errorf(rp.Status)
+		return Token{}, errors.New(rp.Status)
 	}
 
 	data, e := io.ReadAll(rp.Body)
@@ -162,3 +220,14 @@ type errorResponse struct {
 	Error string `json:"error"`
 	ErrorDescription string `json:"error_description"`
 }
+
+var (
+	requestDuration = metrics.NewHistogramVec(
+		"osubot_api_request_duration_seconds",
+		"Duration of osu! API requests.",
+		metrics.DefBuckets,
+		"endpoint",
+	)
+	requestErrors = metrics.NewCounterVec("osubot_api_request_errors_total", "Failed osu! API requests.", "endpoint")
+	tokenRefreshes = metrics.NewCounter("osubot_api_token_refreshes_total", "OAuth token refreshes.")
+)
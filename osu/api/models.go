@@ -11,6 +11,14 @@ type User struct {
 	CountryCode string  `json:"country_code"`
 	IsOnline bool       `json:"is_online"`
 	LastVisit time.Time `json:"last_visit"`
+	Statistics *UserStatistics `json:"statistics,omitempty"`
+}
+
+type UserStatistics struct {
+	PP float32       `json:"pp"`
+	GlobalRank *int  `json:"global_rank"`
+	Accuracy float32 `json:"hit_accuracy"`
+	PlayCount int    `json:"play_count"`
 }
 
 type Mode string
@@ -21,6 +29,8 @@ const (
 	ModeTaiko = "taiko"
 )
 
+var modes = []Mode{ ModeStandard, ModeTaiko, ModeCatch, ModeMania }
+
 type BeatmapSet struct {
 	ID int               `json:"id"`
 	Creator string       `json:"creator"`
@@ -28,6 +38,8 @@ type BeatmapSet struct {
 	ArtistUnicode string `json:"artist_unicode"`
 	Title string         `json:"title"`
 	TitleUnicode string  `json:"title_unicode"`
+	Status string        `json:"status"`
+	Beatmaps []Beatmap   `json:"beatmaps,omitempty"`
 }
 
 type Beatmap struct {
@@ -41,6 +53,19 @@ type Beatmap struct {
 	MaxCombo *int          `json:"max_combo"`
 }
 
+type SearchQuery struct {
+	Query string
+	Mode Mode
+	Status string
+	MinStars, MaxStars float32
+	MinLength, MaxLength int
+}
+
+type SearchResult struct {
+	BeatmapSets []BeatmapSet `json:"beatmapsets"`
+	Total int                `json:"total"`
+}
+
 type Score struct {
 	Accuracy float32 `json:"accuracy"`
 	BeatmapID int    `json:"beatmap_id"`
@@ -50,6 +75,7 @@ type Score struct {
 	PP *float32      `json:"pp"`
 	Rank string      `json:"rank"`
 	Score int        `json:"legacy_total_score"`
+	Beatmap *Beatmap `json:"beatmap,omitempty"`
 }
 
 type BeatmapUserScore struct {
@@ -0,0 +1,297 @@
+package irc
+
+import (
+	"fmt"
+	"context"
+	"log/slog"
+)
+
+type Event struct {
+	Name string
+	Lobby, User string
+	Attrs []any
+	deliver func(Dispatcher)
+}
+
+type Handler func(Event)
+
+type Middleware func(Handler) Handler
+
+type Bus struct {
+	subscribers []Dispatcher
+	middleware []Middleware
+}
+
+func NewBus(subscribers ...Dispatcher) *Bus {
+	return &Bus{ subscribers: subscribers }
+}
+
+func (b *Bus) Subscribe(d Dispatcher) {
+	b.subscribers = append(b.subscribers, d)
+}
+
+func (b *Bus) Use(mw ...Middleware) {
+	b.middleware = append(b.middleware, mw...)
+}
+
+func (b *Bus) emit(e Event) {
+	h := func(e Event) {
+		for _, s := range b.subscribers {
+			e.deliver(s)
+		}
+	}
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		h = b.middleware[i](h)
+	}
+	h(e)
+}
+
+func (e Event) String() string {
+	s := e.Name
+	if e.Lobby != "" {
+		s += " " + e.Lobby
+	}
+	if e.User != "" {
+		s += " " + e.User
+	}
+	for i := 0; i+1 < len(e.Attrs); i += 2 {
+		s += fmt.Sprintf(" %v=%v", e.Attrs[i], e.Attrs[i+1])
+	}
+	return s
+}
+
+func Logging(l *slog.Logger, level slog.Level) Middleware {
+	return func(next Handler) Handler {
+		return func(e Event) {
+			l.Log(context.Background(), level, e.Name, append([]any{"lobby", e.Lobby, "user", e.User}, e.Attrs...)...)
+			next(e)
+		}
+	}
+}
+
+func Filter(keep func(Event) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(e Event) {
+			if keep(e) {
+				next(e)
+			}
+		}
+	}
+}
+
+func Recover(report func(e Event, r any)) Middleware {
+	return func(next Handler) Handler {
+		return func(e Event) {
+			defer func(){
+				if r := recover(); r != nil {
+					report(e, r)
+				}
+			}()
+			deliver := e.deliver
+			e.deliver = func(d Dispatcher) {
+				defer func(){
+					if r := recover(); r != nil {
+						report(e, r)
+					}
+				}()
+				deliver(d)
+			}
+			next(e)
+		}
+	}
+}
+
+func (b *Bus) OnAuthenticated() {
+	b.emit(Event{ Name: "authenticated", deliver: func(d Dispatcher){ d.OnAuthenticated() } })
+}
+
+func (b *Bus) OnAuthenticationError(e string) {
+	b.emit(Event{
+		Name: "authentication error",
+		Attrs: []any{"error", e},
+		deliver: func(d Dispatcher){ d.OnAuthenticationError(e) },
+	})
+}
+
+func (b *Bus) OnJoined(lobby string, players []string) {
+	b.emit(Event{
+		Name: "joined",
+		Lobby: lobby,
+		Attrs: []any{"players", players},
+		deliver: func(d Dispatcher){ d.OnJoined(lobby, players) },
+	})
+}
+
+func (b *Bus) OnJoinError(e string) {
+	b.emit(Event{
+		Name: "join error",
+		Attrs: []any{"error", e},
+		deliver: func(d Dispatcher){ d.OnJoinError(e) },
+	})
+}
+
+func (b *Bus) OnLeft(lobby string) {
+	b.emit(Event{ Name: "left", Lobby: lobby, deliver: func(d Dispatcher){ d.OnLeft(lobby) } })
+}
+
+func (b *Bus) OnClosed(lobby string) {
+	b.emit(Event{ Name: "closed", Lobby: lobby, deliver: func(d Dispatcher){ d.OnClosed(lobby) } })
+}
+
+func (b *Bus) OnUserJoined(lobby, user string) {
+	b.emit(Event{
+		Name: "user joined",
+		Lobby: lobby,
+		User: user,
+		deliver: func(d Dispatcher){ d.OnUserJoined(lobby, user) },
+	})
+}
+
+func (b *Bus) OnUserLeft(lobby, user string) {
+	b.emit(Event{
+		Name: "user left",
+		Lobby: lobby,
+		User: user,
+		deliver: func(d Dispatcher){ d.OnUserLeft(lobby, user) },
+	})
+}
+
+func (b *Bus) OnHostChanged(lobby, user string) {
+	b.emit(Event{
+		Name: "host changed",
+		Lobby: lobby,
+		User: user,
+		deliver: func(d Dispatcher){ d.OnHostChanged(lobby, user) },
+	})
+}
+
+func (b *Bus) OnBeatmapChanged(lobby, artist, title, difficulty string, id int) {
+	b.emit(Event{
+		Name: "beatmap changed",
+		Lobby: lobby,
+		Attrs: []any{"beatmap", fmt.Sprintf("%v - %v [%v]", artist, title, difficulty), "id", id},
+		deliver: func(d Dispatcher){ d.OnBeatmapChanged(lobby, artist, title, difficulty, id) },
+	})
+}
+
+func (b *Bus) OnAllPlayersReady(lobby string) {
+	b.emit(Event{
+		Name: "all players ready",
+		Lobby: lobby,
+		deliver: func(d Dispatcher){ d.OnAllPlayersReady(lobby) },
+	})
+}
+
+func (b *Bus) OnMatchStarted(lobby string) {
+	b.emit(Event{ Name: "match started", Lobby: lobby, deliver: func(d Dispatcher){ d.OnMatchStarted(lobby) } })
+}
+
+func (b *Bus) OnPlayerFinished(lobby, user string, score int, passed bool) {
+	b.emit(Event{
+		Name: "player finished",
+		Lobby: lobby,
+		User: user,
+		Attrs: []any{"score", score, "passed", passed},
+		deliver: func(d Dispatcher){ d.OnPlayerFinished(lobby, user, score, passed) },
+	})
+}
+
+func (b *Bus) OnMatchFinished(lobby string) {
+	b.emit(Event{ Name: "match finished", Lobby: lobby, deliver: func(d Dispatcher){ d.OnMatchFinished(lobby) } })
+}
+
+func (b *Bus) OnMatchAborted(lobby string) {
+	b.emit(Event{ Name: "match aborted", Lobby: lobby, deliver: func(d Dispatcher){ d.OnMatchAborted(lobby) } })
+}
+
+func (b *Bus) OnSettingsPlayers(lobby string, count int) {
+	b.emit(Event{
+		Name: "settings players",
+		Lobby: lobby,
+		Attrs: []any{"count", count},
+		deliver: func(d Dispatcher){ d.OnSettingsPlayers(lobby, count) },
+	})
+}
+
+func (b *Bus) OnSettingsSlot(lobby string, slot int, user string, host bool) {
+	b.emit(Event{
+		Name: "settings slot",
+		Lobby: lobby,
+		User: user,
+		Attrs: []any{"slot", slot, "host", host},
+		deliver: func(d Dispatcher){ d.OnSettingsSlot(lobby, slot, user, host) },
+	})
+}
+
+func (b *Bus) OnUserMessage(lobby, user, message string) {
+	b.emit(Event{
+		Name: "message",
+		Lobby: lobby,
+		User: user,
+		Attrs: []any{"text", message},
+		deliver: func(d Dispatcher){ d.OnUserMessage(lobby, user, message) },
+	})
+}
+
+func (b *Bus) OnUserAction(lobby, user, action string) {
+	b.emit(Event{
+		Name: "action",
+		Lobby: lobby,
+		User: user,
+		Attrs: []any{"text", action},
+		deliver: func(d Dispatcher){ d.OnUserAction(lobby, user, action) },
+	})
+}
+
+func (b *Bus) OnUserCommand(lobby, user, command string, args []string) {
+	b.emit(Event{
+		Name: "user command",
+		Lobby: lobby,
+		User: user,
+		Attrs: []any{"command", command, "args", args},
+		deliver: func(d Dispatcher){ d.OnUserCommand(lobby, user, command, args) },
+	})
+}
+
+func (b *Bus) OnPrivateMessage(user, message string) {
+	b.emit(Event{
+		Name: "private message",
+		User: user,
+		Attrs: []any{"text", message},
+		deliver: func(d Dispatcher){ d.OnPrivateMessage(user, message) },
+	})
+}
+
+func (b *Bus) OnPrivateCommand(user, command string, args []string) {
+	b.emit(Event{
+		Name: "private command",
+		User: user,
+		Attrs: []any{"command", command, "args", args},
+		deliver: func(d Dispatcher){ d.OnPrivateCommand(user, command, args) },
+	})
+}
+
+type BaseDispatcher struct{}
+
+func (BaseDispatcher) OnAuthenticated() {}
+func (BaseDispatcher) OnAuthenticationError(e string) {}
+func (BaseDispatcher) OnJoined(lobby string, players []string) {}
+func (BaseDispatcher) OnJoinError(e string) {}
+func (BaseDispatcher) OnLeft(lobby string) {}
+func (BaseDispatcher) OnClosed(lobby string) {}
+func (BaseDispatcher) OnUserJoined(lobby, user string) {}
+func (BaseDispatcher) OnUserLeft(lobby, user string) {}
+func (BaseDispatcher) OnHostChanged(lobby, user string) {}
+func (BaseDispatcher) OnBeatmapChanged(lobby, artist, title, difficulty string, id int) {}
+func (BaseDispatcher) OnAllPlayersReady(lobby string) {}
+func (BaseDispatcher) OnMatchStarted(lobby string) {}
+func (BaseDispatcher) OnPlayerFinished(lobby, user string, score int, passed bool) {}
+func (BaseDispatcher) OnMatchFinished(lobby string) {}
+func (BaseDispatcher) OnMatchAborted(lobby string) {}
+func (BaseDispatcher) OnSettingsPlayers(lobby string, count int) {}
+func (BaseDispatcher) OnSettingsSlot(lobby string, slot int, user string, host bool) {}
+func (BaseDispatcher) OnUserMessage(lobby, user, message string) {}
+func (BaseDispatcher) OnUserAction(lobby, user, action string) {}
+func (BaseDispatcher) OnUserCommand(lobby, user, command string, args []string) {}
+func (BaseDispatcher) OnPrivateMessage(user, message string) {}
+func (BaseDispatcher) OnPrivateCommand(user, command string, args []string) {}
@@ -1,103 +1,172 @@
 package irc
 
 import (
+	"io"
 	"fmt"
-	"net"
+	"sync"
 	"time"
 	"bufio"
+	"errors"
+	"strconv"
 	"strings"
-	"unicode"
+	"log/slog"
+
+	"osubot/metrics"
+	"osubot/recording"
 )
 
 type Conn struct {
-	conn net.Conn
+	conn io.ReadWriteCloser
 	scanner *bufio.Scanner
 	limiter *time.Ticker
+	rec *recording.Recorder
+	readTimeout time.Duration
+	pinger *pinger
 }
 
-type Msg struct {
-	Src, Cmd string
-	Args []string
+type pinger struct {
+	mu sync.Mutex
+	pending string
+	timedOut bool
+	done chan struct{}
+	stop sync.Once
 }
 
+var ErrPingTimeout = errors.New("irc: ping timeout")
+
 func Connect(addr string, rateLimit float32) (c Conn, e error) {
-	c.conn, e = net.Dial("tcp", addr)
-	if e != nil {
-		return
+	return Dialer{}.Connect(addr, rateLimit)
+}
+
+func NewConn(conn io.ReadWriteCloser, rateLimit float32) (c Conn) {
+	c.conn = conn
+	c.scanner = bufio.NewScanner(conn)
+	if rateLimit > 0 {
+		c.limiter = time.NewTicker(time.Duration((1 / rateLimit) * float32(time.Second)))
 	}
-	c.scanner = bufio.NewScanner(c.conn)
-	c.limiter = time.NewTicker(time.Duration((1 / rateLimit) * float32(time.Second)))
 	return
 }
 
 func (c Conn) Close() error {
+	c.stopPinging()
 	return c.conn.Close()
 }
 
+func (c *Conn) startPinging(interval, timeout time.Duration) {
+	c.pinger = &pinger{ done: make(chan struct{}) }
+	go c.ping(interval, timeout)
+}
+
+func (c Conn) stopPinging() {
+	if c.pinger != nil {
+		c.pinger.stop.Do(func(){ close(c.pinger.done) })
+	}
+}
+
+func (c Conn) ping(interval, timeout time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-c.pinger.done:
+			return
+		case <-t.C:
+		}
+
+		token := strconv.FormatInt(time.Now().UnixNano(), 36)
+		c.pinger.mu.Lock()
+		c.pinger.pending = token
+		c.pinger.mu.Unlock()
+		c.Send("PING", token)
+
+		select {
+		case <-c.pinger.done:
+			return
+		case <-time.After(timeout):
+		}
+
+		c.pinger.mu.Lock()
+		c.pinger.timedOut = c.pinger.pending != ""
+		timedOut := c.pinger.timedOut
+		c.pinger.mu.Unlock()
+		if timedOut {
+			slog.Warn("IRC server did not answer PING", "timeout", timeout)
+			c.Close()
+			return
+		}
+	}
+}
+
 func (c Conn) Send(cmd string, args ...any) {
-	<-c.limiter.C
+	if c.limiter != nil {
+		sendQueueDepth.Inc()
+		t := time.Now()
+		<-c.limiter.C
+		sendWait.Observe(time.Since(t).Seconds())
+		sendQueueDepth.Dec()
+	}
+	messagesSent.Inc()
 
 	sArgs := make([]string, len(args), len(args))
 	for i, a := range args {
 		sArgs[i] = fmt.Sprintf("%v", a)
 	}
 
-	c.conn.Write([]byte(fmt.Sprintf("%v %v\n", cmd, strings.Join(sArgs, " "))))
+	m := Msg{ Cmd: cmd, Params: sArgs }
+	if len(sArgs) > 1 {
+		m.Params, m.Trailing, m.HasTrailing = sArgs[:1], strings.Join(sArgs[1:], " "), true
+	}
+	l := m.Encode()
+	if cmd == "PASS" {
+		slog.Debug("IRC send", "line", "PASS ***")
+		c.rec.Record(recording.Entry{ Dir: recording.DirOut, Line: "PASS ***" })
+	} else {
+		slog.Debug("IRC send", "line", l)
+		c.rec.Record(recording.Entry{ Dir: recording.DirOut, Line: l })
+	}
+	c.conn.Write([]byte(l + "\n"))
 }
 
 func (conn Conn) Recv() (m Msg, e error) {
+	if d, ok := conn.conn.(interface{ SetReadDeadline(time.Time) error }); ok && conn.readTimeout > 0 {
+		d.SetReadDeadline(time.Now().Add(conn.readTimeout))
+	}
 	if !conn.scanner.Scan() {
 		e = conn.scanner.Err()
 		if e == nil {
-			e = net.ErrClosed
+			e = io.EOF
+		}
+		if conn.pinger != nil {
+			conn.pinger.mu.Lock()
+			if conn.pinger.timedOut {
+				e = ErrPingTimeout
+			}
+			conn.pinger.mu.Unlock()
+			conn.stopPinging()
 		}
 		return
 	}
 	l := conn.scanner.Text()
-	c := 0
-	if c = strings.IndexFunc(l, notSpace); c == -1 {
-		return
-	}
-	l = l[c:]
-	if strings.HasPrefix(l, ":") {
-		l = l[1:]
-		if c = strings.IndexFunc(l, unicode.IsSpace); c == -1 {
-			return
-		}
-		if b := strings.IndexRune(l[:c], '!'); b != -1 {
-			m.Src = l[:b]
-		} else {
-			m.Src = l[:c]
-		}
-		l = l[c:]
-		if c = strings.IndexFunc(l, notSpace); c == -1 {
-			return
-		}
-		l = l[c:]
-	}
-	if c = strings.IndexFunc(l, unicode.IsSpace); c == -1 {
-		c = len(l)
-	}
-	m.Cmd = l[:c]
-	l = l[c:]
-	for {
-		if c = strings.IndexFunc(l, notSpace); c == -1 {
-			break
-		}
-		l = l[c:]
-		if strings.HasPrefix(l, ":") {
-			m.Args = append(m.Args, l[1:])
-			break
-		}
-		if c = strings.IndexFunc(l, unicode.IsSpace); c == -1 {
-			c = len(l)
-		}
-		m.Args = append(m.Args, l[:c])
-		l = l[c:]
+	messagesReceived.Inc()
+	slog.Debug("IRC recv", "line", l)
+	conn.rec.Record(recording.Entry{ Dir: recording.DirIn, Line: l })
+	m = Parse(l)
+	if m.Cmd == "PONG" && conn.pinger != nil {
+		conn.pinger.mu.Lock()
+		conn.pinger.pending = ""
+		conn.pinger.mu.Unlock()
 	}
 	return
 }
 
-func notSpace(r rune) bool {
-	return !unicode.IsSpace(r)
-}
+var (
+	messagesSent = metrics.NewCounter("osubot_irc_messages_sent_total", "IRC messages sent.")
+	messagesReceived = metrics.NewCounter("osubot_irc_messages_received_total", "IRC messages received.")
+	sendQueueDepth = metrics.NewGauge("osubot_irc_send_queue_depth", "IRC messages waiting for the rate limiter.")
+	sendWait = metrics.NewHistogram(
+		"osubot_irc_send_wait_seconds",
+		"Time IRC messages spent waiting for the rate limiter.",
+		metrics.DefBuckets,
+	)
+)
@@ -0,0 +1,167 @@
+package irc
+
+import (
+	"fmt"
+	"net"
+	"time"
+	"bufio"
+	"context"
+	"net/url"
+	"net/http"
+	"crypto/tls"
+	"encoding/base64"
+
+	"golang.org/x/net/proxy"
+
+	"osubot/recording"
+)
+
+type Dialer struct {
+	TLS bool
+	TLSConfig *tls.Config
+	Timeout time.Duration
+	ReadTimeout time.Duration
+	KeepAlive time.Duration
+	Proxy string
+	PingInterval time.Duration
+	PingTimeout time.Duration
+	Recorder *recording.Recorder
+}
+
+func (d Dialer) Connect(addr string, rateLimit float32) (c Conn, e error) {
+	conn, e := d.Dial(addr)
+	if e != nil {
+		return
+	}
+	c = NewConn(conn, rateLimit)
+	c.rec = d.Recorder
+	c.readTimeout = d.ReadTimeout
+	if d.PingInterval > 0 {
+		timeout := d.PingTimeout
+		if timeout <= 0 {
+			timeout = d.PingInterval
+		}
+		if c.readTimeout <= 0 {
+			c.readTimeout = d.PingInterval + timeout
+		}
+		c.startPinging(d.PingInterval, timeout)
+	}
+	return
+}
+
+func (d Dialer) Dial(addr string) (net.Conn, error) {
+	host, port, e := net.SplitHostPort(addr)
+	if e != nil {
+		return nil, e
+	}
+
+	ctx := context.Background()
+	if d.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.Timeout)
+		defer cancel()
+	}
+
+	conn, e := d.dialTCP(ctx, addr)
+	if e != nil {
+		return nil, e
+	}
+
+	if !d.TLS && port != "6697" {
+		return conn, nil
+	}
+
+	cfg := d.TLSConfig
+	if cfg == nil {
+		cfg = &tls.Config{}
+	}
+	cfg = cfg.Clone()
+	if cfg.ServerName == "" {
+		cfg.ServerName = host
+	}
+	tlsConn := tls.Client(conn, cfg)
+	if e = tlsConn.HandshakeContext(ctx); e != nil {
+		conn.Close()
+		return nil, e
+	}
+	return tlsConn, nil
+}
+
+func (d Dialer) dialTCP(ctx context.Context, addr string) (net.Conn, error) {
+	nd := &net.Dialer{ KeepAlive: d.KeepAlive }
+	if d.Proxy == "" {
+		return nd.DialContext(ctx, "tcp", addr)
+	}
+
+	u, e := url.Parse(d.Proxy)
+	if e != nil {
+		return nil, e
+	}
+
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		var auth *proxy.Auth
+		if u.User != nil {
+			p, _ := u.User.Password()
+			auth = &proxy.Auth{ User: u.User.Username(), Password: p }
+		}
+		pd, e := proxy.SOCKS5("tcp", u.Host, auth, nd)
+		if e != nil {
+			return nil, e
+		}
+		return pd.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+	case "http":
+		return dialHTTPProxy(ctx, nd, u, addr)
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+	}
+}
+
+func dialHTTPProxy(ctx context.Context, nd *net.Dialer, u *url.URL, addr string) (net.Conn, error) {
+	conn, e := nd.DialContext(ctx, "tcp", u.Host)
+	if e != nil {
+		return nil, e
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+		defer conn.SetDeadline(time.Time{})
+	}
+
+	rq := &http.Request{
+		Method: "CONNECT",
+		URL: &url.URL{ Opaque: addr },
+		Host: addr,
+		Header: http.Header{},
+	}
+	if u.User != nil {
+		p, _ := u.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + p))
+		rq.Header.Set("Proxy-Authorization", "Basic " + creds)
+	}
+	if e = rq.Write(conn); e != nil {
+		conn.Close()
+		return nil, e
+	}
+
+	r := bufio.NewReader(conn)
+	rp, e := http.ReadResponse(r, rq)
+	if e != nil {
+		conn.Close()
+		return nil, e
+	}
+	rp.Body.Close()
+	if rp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy: %v", rp.Status)
+	}
+	return &bufferedConn{ Conn: conn, r: r }, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -21,68 +21,104 @@ type Dispatcher interface {
 	OnBeatmapChanged(lobby, artist, title, difficulty string, id int)
 	OnAllPlayersReady(lobby string)
 	OnMatchStarted(lobby string)
+	OnPlayerFinished(lobby, user string, score int, passed bool)
 	OnMatchFinished(lobby string)
 	OnMatchAborted(lobby string)
+	OnSettingsPlayers(lobby string, count int)
+	OnSettingsSlot(lobby string, slot int, user string, host bool)
 	OnUserMessage(lobby, user, message string)
+	OnUserAction(lobby, user, action string)
 	OnUserCommand(lobby, user, command string, args []string)
+	OnPrivateMessage(user, message string)
+	OnPrivateCommand(user, command string, args []string)
 }
 
 func Dispatch(m Msg, d Dispatcher) {
-	if m.Cmd == "001" {
+	lobby, text := m.Arg(0), m.Text()
+	if m.Cmd == RPL_WELCOME {
 		d.OnAuthenticated()
-	} else if m.Cmd == "464" {
-		d.OnAuthenticationError(m.Args[1])
-	} else if m.Cmd == "372" && strings.HasPrefix(m.Args[1], "- You are required to authenticate") {
+	} else if m.Cmd == ERR_PASSWDMISMATCH {
+		d.OnAuthenticationError(text)
+	} else if m.Cmd == RPL_MOTD && strings.HasPrefix(text, "- You are required to authenticate") {
 		d.OnAuthenticationError("Invalid IRC credentials")
-	} else if m.Cmd == "403" {
-		d.OnJoinError(m.Args[2])
-	} else if m.Cmd == "353" {
-		players := strings.Fields(m.Args[3])
-		players = players[1:len(players)-1]
-		d.OnJoined(m.Args[2], players)
+	} else if m.Cmd == ERR_NOSUCHCHANNEL {
+		d.OnJoinError(text)
+	} else if m.Cmd == RPL_NAMREPLY {
+		var players []string
+		if p := strings.Fields(text); len(p) > 1 {
+			players = p[1:len(p)-1]
+		}
+		d.OnJoined(m.Arg(2), players)
 	} else if m.Cmd == "PART" {
-		d.OnLeft(m.Args[0])
+		d.OnLeft(lobby)
 	} else if m.Cmd == "PRIVMSG" {
-		if m.Src == "BanchoBot" {
-			if g := userJoinedRe.FindStringSubmatch(m.Args[1]); g != nil {
-				d.OnUserJoined(m.Args[0], g[1])
-			} else if g := userLeftRe.FindStringSubmatch(m.Args[1]); g != nil {
-				d.OnUserLeft(m.Args[0], g[1])
-			} else if g := hostChangedRe.FindStringSubmatch(m.Args[1]); g != nil {
-				d.OnHostChanged(m.Args[0], g[1])
-			} else if g := beatmapChangedRe.FindStringSubmatch(m.Args[1]); g != nil {
+		if m.Nick == "BanchoBot" {
+			if g := userJoinedRe.FindStringSubmatch(text); g != nil {
+				d.OnUserJoined(lobby, g[1])
+			} else if g := userLeftRe.FindStringSubmatch(text); g != nil {
+				d.OnUserLeft(lobby, g[1])
+			} else if g := hostChangedRe.FindStringSubmatch(text); g != nil {
+				d.OnHostChanged(lobby, g[1])
+			} else if g := beatmapChangedRe.FindStringSubmatch(text); g != nil {
 				if id, e := strconv.Atoi(g[4]); e == nil {
-					d.OnBeatmapChanged(m.Args[0], g[1], g[2], g[3], id)
+					d.OnBeatmapChanged(lobby, g[1], g[2], g[3], id)
+				}
+			} else if g := playerFinishedRe.FindStringSubmatch(text); g != nil {
+				if score, e := strconv.Atoi(g[2]); e == nil {
+					d.OnPlayerFinished(lobby, g[1], score, g[3] == "PASSED")
+				}
+			} else if g := settingsPlayersRe.FindStringSubmatch(text); g != nil {
+				if count, e := strconv.Atoi(g[1]); e == nil {
+					d.OnSettingsPlayers(lobby, count)
 				}
-			} else if m.Args[1] == "All players are ready" {
-				d.OnAllPlayersReady(m.Args[0])
-			} else if m.Args[1] == "The match has started!" {
-				d.OnMatchStarted(m.Args[0])
-			} else if m.Args[1] == "The match has finished!" {
-				d.OnMatchFinished(m.Args[0])
-			} else if m.Args[1] == "Aborted the match" {
-				d.OnMatchAborted(m.Args[0])
-			} else if m.Args[1] == "Closed the match" {
-				d.OnClosed(m.Args[0])
+			} else if g := settingsSlotRe.FindStringSubmatch(text); g != nil {
+				if slot, e := strconv.Atoi(g[1]); e == nil {
+					d.OnSettingsSlot(lobby, slot, g[2], strings.Contains(g[3], "Host"))
+				}
+			} else if text == "All players are ready" {
+				d.OnAllPlayersReady(lobby)
+			} else if text == "The match has started!" {
+				d.OnMatchStarted(lobby)
+			} else if text == "The match has finished!" {
+				d.OnMatchFinished(lobby)
+			} else if text == "Aborted the match" {
+				d.OnMatchAborted(lobby)
+			} else if text == "Closed the match" {
+				d.OnClosed(lobby)
 			}
-		} else {
-			text := strings.Join(m.Args[1:], " ")
+		} else if !strings.HasPrefix(lobby, "#") {
 			if len(text) > 1 && text[0] == '!' {
-				if args, e := shlex.Split(text); e == nil {
-					d.OnUserCommand(m.Args[0], m.Src, args[0][1:], args[1:])
+				if args, e := shlex.Split(text); e == nil && len(args) > 0 {
+					d.OnPrivateCommand(m.Nick, args[0][1:], args[1:])
 				}
-			} else {
-				d.OnUserMessage(m.Args[0], m.Src, text)
+			} else if _, ok := m.CTCP(); !ok {
+				d.OnPrivateMessage(m.Nick, text)
 			}
+		} else if ctcp, ok := m.CTCP(); ok {
+			if ctcp.Command == "ACTION" {
+				d.OnUserAction(lobby, m.Nick, ctcp.Args)
+			}
+		} else if len(text) > 1 && text[0] == '!' {
+			if args, e := shlex.Split(text); e == nil && len(args) > 0 {
+				d.OnUserCommand(lobby, m.Nick, args[0][1:], args[1:])
+			}
+		} else {
+			d.OnUserMessage(lobby, m.Nick, text)
 		}
 	}
 }
 
-var userJoinedRe, userLeftRe, hostChangedRe, beatmapChangedRe *regexp.Regexp
+var (
+	userJoinedRe, userLeftRe, hostChangedRe, beatmapChangedRe, playerFinishedRe *regexp.Regexp
+	settingsPlayersRe, settingsSlotRe *regexp.Regexp
+)
 
 func init() {
 	userJoinedRe, _ = regexp.Compile(`(\w+) joined in slot (\d+)\.`)
 	userLeftRe, _ = regexp.Compile(`(\w+) left the game\.`)
 	hostChangedRe, _ = regexp.Compile(`(\w+) became the host\.`)
 	beatmapChangedRe, _ = regexp.Compile(`Beatmap changed to: (.+) - (.+) \[(.+)\] \(https://osu\.ppy\.sh/b/(\d+)\)`)
+	settingsPlayersRe, _ = regexp.Compile(`^Players: (\d+)$`)
+	settingsSlotRe, _ = regexp.Compile(`^Slot (\d+)\s+.+? https://osu\.ppy\.sh/u/\d+ (.+?)\s*(?:\[(.+)\])?$`)
+	playerFinishedRe, _ = regexp.Compile(`^(.+?) finished playing \(Score: (\d+), (PASSED|FAILED)\)\.$`)
 }
@@ -0,0 +1,121 @@
+package irc
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	RPL_WELCOME = "001"
+	RPL_MOTD = "372"
+	RPL_NAMREPLY = "353"
+	RPL_ENDOFNAMES = "366"
+	ERR_NOSUCHCHANNEL = "403"
+	ERR_PASSWDMISMATCH = "464"
+)
+
+type Prefix struct {
+	Nick, User, Host string
+}
+
+type Msg struct {
+	Prefix
+	Cmd string
+	Params []string
+	Trailing string
+	HasTrailing bool
+	Raw string
+}
+
+type CTCP struct {
+	Command, Args string
+}
+
+func Parse(l string) (m Msg) {
+	m.Raw = l
+	l = strings.TrimRight(l, "\r\n")
+	l = strings.TrimLeftFunc(l, unicode.IsSpace)
+
+	if strings.HasPrefix(l, ":") {
+		var p string
+		p, l, _ = strings.Cut(l[1:], " ")
+		p, m.Host, _ = strings.Cut(p, "@")
+		m.Nick, m.User, _ = strings.Cut(p, "!")
+		l = strings.TrimLeft(l, " ")
+	}
+
+	m.Cmd, l, _ = strings.Cut(l, " ")
+	for {
+		if l = strings.TrimLeft(l, " "); l == "" {
+			break
+		}
+		if strings.HasPrefix(l, ":") {
+			m.Trailing, m.HasTrailing = l[1:], true
+			break
+		}
+		var p string
+		p, l, _ = strings.Cut(l, " ")
+		m.Params = append(m.Params, p)
+	}
+	return
+}
+
+func (m Msg) Encode() string {
+	var sb strings.Builder
+	if m.Nick != "" {
+		sb.WriteString(":" + m.Nick)
+		if m.User != "" {
+			sb.WriteString("!" + m.User)
+		}
+		if m.Host != "" {
+			sb.WriteString("@" + m.Host)
+		}
+		sb.WriteString(" ")
+	}
+	sb.WriteString(m.Cmd)
+
+	params, trailing, hasTrailing := m.Params, m.Trailing, m.HasTrailing
+	if !hasTrailing && len(params) > 0 {
+		last := params[len(params)-1]
+		if last == "" || strings.HasPrefix(last, ":") || strings.ContainsRune(last, ' ') {
+			params, trailing, hasTrailing = params[:len(params)-1], last, true
+		}
+	}
+	for _, p := range params {
+		sb.WriteString(" " + p)
+	}
+	if hasTrailing {
+		sb.WriteString(" :" + trailing)
+	}
+	return sb.String()
+}
+
+func (m Msg) Arg(i int) string {
+	if i < len(m.Params) {
+		return m.Params[i]
+	}
+	if i == len(m.Params) && m.HasTrailing {
+		return m.Trailing
+	}
+	return ""
+}
+
+func (m Msg) Text() string {
+	if m.HasTrailing {
+		return m.Trailing
+	}
+	if len(m.Params) > 1 {
+		return m.Params[len(m.Params)-1]
+	}
+	return ""
+}
+
+func (m Msg) CTCP() (c CTCP, ok bool) {
+	t := m.Text()
+	if len(t) < 2 || t[0] != '\x01' {
+		return
+	}
+	t = strings.TrimSuffix(t[1:], "\x01")
+	c.Command, c.Args, _ = strings.Cut(t, " ")
+	return c, c.Command != ""
+}
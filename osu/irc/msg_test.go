@@ -0,0 +1,121 @@
+package irc
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		line string
+		want Msg
+	}{
+		{ "PING :cho.ppy.sh\r\n", Msg{ Cmd: "PING", Trailing: "cho.ppy.sh", HasTrailing: true } },
+		{ "PING cho.ppy.sh", Msg{ Cmd: "PING", Params: []string{"cho.ppy.sh"} } },
+		{
+			":alice!cho@ppy.sh PRIVMSG #mp_1 :hello  world",
+			Msg{ Prefix: Prefix{ "alice", "cho", "ppy.sh" }, Cmd: "PRIVMSG", Params: []string{"#mp_1"}, Trailing: "hello  world", HasTrailing: true },
+		},
+		{ ":cho.ppy.sh 464 owner :", Msg{ Prefix: Prefix{ Nick: "cho.ppy.sh" }, Cmd: "464", Params: []string{"owner"}, HasTrailing: true } },
+		{ ":cho.ppy.sh 464 owner", Msg{ Prefix: Prefix{ Nick: "cho.ppy.sh" }, Cmd: "464", Params: []string{"owner"} } },
+		{ ":cho.ppy.sh  353  owner = #mp_1 ", Msg{ Prefix: Prefix{ Nick: "cho.ppy.sh" }, Cmd: "353", Params: []string{"owner", "=", "#mp_1"} } },
+		{ "PRIVMSG #mp_1 ::)", Msg{ Cmd: "PRIVMSG", Params: []string{"#mp_1"}, Trailing: ":)", HasTrailing: true } },
+	}
+	for _, tt := range tests {
+		got := Parse(tt.line)
+		tt.want.Raw = tt.line
+		if got.Prefix != tt.want.Prefix || got.Cmd != tt.want.Cmd || !slices.Equal(got.Params, tt.want.Params) ||
+			got.Trailing != tt.want.Trailing || got.HasTrailing != tt.want.HasTrailing || got.Raw != tt.want.Raw {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		line, want string
+	}{
+		{ "PRIVMSG #mp_1 :hello world", "hello world" },
+		{ "PRIVMSG #mp_1 hello", "hello" },
+		{ ":cho.ppy.sh 464 owner :Bad authentication token.", "Bad authentication token." },
+		{ ":cho.ppy.sh 464 owner", "" },
+		{ ":cho.ppy.sh 353 owner = #mp_1", "#mp_1" },
+		{ ":cho.ppy.sh 353 owner = #mp_1 :", "" },
+		{ "PING cho.ppy.sh", "" },
+	}
+	for _, tt := range tests {
+		if got := Parse(tt.line).Text(); got != tt.want {
+			t.Errorf("Parse(%q).Text() = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		msg Msg
+		want string
+	}{
+		{ Msg{ Cmd: "PONG", Params: []string{"cho.ppy.sh"} }, "PONG cho.ppy.sh" },
+		{ Msg{ Cmd: "PRIVMSG", Params: []string{"#mp_1", "!mp host alice"} }, "PRIVMSG #mp_1 :!mp host alice" },
+		{ Msg{ Cmd: "PRIVMSG", Params: []string{"#mp_1", ":)"} }, "PRIVMSG #mp_1 ::)" },
+		{ Msg{ Cmd: "PASS", Params: []string{""} }, "PASS :" },
+		{ Msg{ Cmd: "PRIVMSG", Params: []string{"#mp_1"}, Trailing: "hi", HasTrailing: true }, "PRIVMSG #mp_1 :hi" },
+		{ Msg{ Prefix: Prefix{ "alice", "cho", "ppy.sh" }, Cmd: "JOIN", Params: []string{"#mp_1"} }, ":alice!cho@ppy.sh JOIN #mp_1" },
+	}
+	for _, tt := range tests {
+		got := tt.msg.Encode()
+		if got != tt.want {
+			t.Errorf("%+v.Encode() = %q, want %q", tt.msg, got, tt.want)
+		}
+		if p := Parse(got); p.Encode() != got {
+			t.Errorf("Parse(%q).Encode() = %q", got, p.Encode())
+		}
+	}
+}
+
+func TestCTCP(t *testing.T) {
+	tests := []struct {
+		line string
+		want CTCP
+		ok bool
+	}{
+		{ "PRIVMSG #mp_1 :\x01ACTION is listening to [https://osu.ppy.sh/b/1 Song]\x01", CTCP{ "ACTION", "is listening to [https://osu.ppy.sh/b/1 Song]" }, true },
+		{ "PRIVMSG #mp_1 :\x01VERSION\x01", CTCP{ Command: "VERSION" }, true },
+		{ "PRIVMSG #mp_1 :\x01ACTION waves", CTCP{ "ACTION", "waves" }, true },
+		{ "PRIVMSG #mp_1 :\x01", CTCP{}, false },
+		{ "PRIVMSG #mp_1 :hello", CTCP{}, false },
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.line).CTCP()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Parse(%q).CTCP() = %+v, %v, want %+v, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+type testDispatcher struct {
+	BaseDispatcher
+	authError string
+	lobby string
+	players []string
+}
+
+func (d *testDispatcher) OnAuthenticationError(e string) {
+	d.authError = e
+}
+
+func (d *testDispatcher) OnJoined(lobby string, players []string) {
+	d.lobby, d.players = lobby, players
+}
+
+func TestDispatchShortReplies(t *testing.T) {
+	var d testDispatcher
+	Dispatch(Parse(":cho.ppy.sh 464 owner"), &d)
+	if d.authError != "" {
+		t.Errorf("short 464 reported %q", d.authError)
+	}
+	Dispatch(Parse(":cho.ppy.sh 353 owner = #mp_1"), &d)
+	if d.lobby != "#mp_1" || len(d.players) != 0 {
+		t.Errorf("short 353 joined %q with %v", d.lobby, d.players)
+	}
+}
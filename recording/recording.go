@@ -0,0 +1,149 @@
+package recording
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+	"bufio"
+	"bytes"
+	"strings"
+	"net/http"
+	"encoding/json"
+)
+
+const (
+	DirStart = "start"
+	DirIn = "in"
+	DirOut = "out"
+	DirAPI = "api"
+)
+
+type Entry struct {
+	Time time.Time `json:"time"`
+	Dir string     `json:"dir"`
+	Line string    `json:"line,omitempty"`
+	Status int     `json:"status,omitempty"`
+	Body string    `json:"body,omitempty"`
+}
+
+type Recorder struct {
+	mu sync.Mutex
+	enc *json.Encoder
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{ enc: json.NewEncoder(w) }
+}
+
+func (r *Recorder) Record(e Entry) {
+	if r == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(e)
+}
+
+func LoadFile(path string) ([]Entry, error) {
+	f, e := os.Open(path)
+	if e != nil {
+		return nil, e
+	}
+	defer f.Close()
+
+	var entries []Entry
+	s := bufio.NewScanner(f)
+	s.Buffer(nil, 16 << 20)
+	for s.Scan() {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		var entry Entry
+		if e = json.Unmarshal(s.Bytes(), &entry); e != nil {
+			return nil, e
+		}
+		entries = append(entries, entry)
+	}
+	return entries, s.Err()
+}
+
+type Transport struct {
+	Recorder *Recorder
+	Base http.RoundTripper
+}
+
+func (t Transport) RoundTrip(rq *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	rp, e := base.RoundTrip(rq)
+	if e != nil || rq.URL.Path == "/oauth/token" {
+		return rp, e
+	}
+
+	body, e := io.ReadAll(rp.Body)
+	rp.Body.Close()
+	if e != nil {
+		return nil, e
+	}
+	rp.Body = io.NopCloser(bytes.NewReader(body))
+
+	t.Recorder.Record(Entry{
+		Dir: DirAPI,
+		Line: rq.Method + " " + rq.URL.RequestURI(),
+		Status: rp.StatusCode,
+		Body: string(body),
+	})
+	return rp, nil
+}
+
+type ReplayTransport struct {
+	mu sync.Mutex
+	responses map[string][]Entry
+}
+
+func NewReplayTransport(entries []Entry) *ReplayTransport {
+	t := &ReplayTransport{ responses: map[string][]Entry{} }
+	for _, e := range entries {
+		if e.Dir == DirAPI {
+			t.responses[e.Line] = append(t.responses[e.Line], e)
+		}
+	}
+	return t
+}
+
+func (t *ReplayTransport) RoundTrip(rq *http.Request) (*http.Response, error) {
+	if rq.URL.Path == "/oauth/token" {
+		return response(rq, http.StatusOK, `{"access_token":"replay","expires_in":86400}`), nil
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := rq.Method + " " + rq.URL.RequestURI()
+	rps := t.responses[key]
+	if len(rps) == 0 {
+		return response(rq, http.StatusNotFound, `{"error":"not recorded"}`), nil
+	}
+	if len(rps) > 1 {
+		t.responses[key] = rps[1:]
+	}
+	return response(rq, rps[0].Status, rps[0].Body), nil
+}
+
+func response(rq *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		Status: http.StatusText(status),
+		StatusCode: status,
+		Header: http.Header{ "Content-Type": {"application/json"} },
+		Body: io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request: rq,
+	}
+}
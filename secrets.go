@@ -0,0 +1,190 @@
+package osubot
+
+import (
+	"os"
+	"fmt"
+	"errors"
+	"strings"
+	"net/url"
+	"crypto/aes"
+	"crypto/rand"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/json"
+	"encoding/base64"
+)
+
+const (
+	encryptedPrefix = "enc:"
+	kdfIterations = 600000
+)
+
+var ErrWrongPassphrase = errors.New("wrong passphrase or corrupted secret")
+
+type Secrets struct {
+	IRCPassword string `json:"irc_password,omitempty"`
+	APISecret string   `json:"api_secret,omitempty"`
+	HTTPToken string   `json:"http_token,omitempty"`
+}
+
+func (s *Secrets) LoadFile(path string) error {
+	b, e := os.ReadFile(path)
+	if e != nil {
+		return e
+	}
+	if e = json.Unmarshal(b, s); e != nil {
+		return fmt.Errorf("%v: %w", path, e)
+	}
+	return nil
+}
+
+func (s Secrets) SaveFile(path string) error {
+	b, e := json.MarshalIndent(s, "", "\t")
+	if e != nil {
+		return e
+	}
+	return writeFileAtomic(path, b, 0600)
+}
+
+func (s *Secrets) fields() []*string {
+	return []*string{ &s.IRCPassword, &s.APISecret, &s.HTTPToken }
+}
+
+func (c *Config) secretFields() []*string {
+	return []*string{ &c.IRC.Pass, &c.API.Secret, &c.HTTP.Token }
+}
+
+func (c *Config) LoadSecrets() error {
+	if c.Secrets == "" {
+		return nil
+	}
+	var s Secrets
+	if e := s.LoadFile(c.Secrets); e != nil {
+		return e
+	}
+	fields := c.secretFields()
+	for i, v := range s.fields() {
+		if *v != "" {
+			*fields[i] = *v
+		}
+	}
+	return nil
+}
+
+func (c *Config) SecretValues() (values []string) {
+	for _, v := range c.secretFields() {
+		if *v != "" {
+			values = append(values, *v)
+		}
+	}
+	if u, e := url.Parse(c.IRC.Proxy); e == nil && u.User != nil {
+		if p, ok := u.User.Password(); ok && p != "" {
+			values = append(values, p)
+		}
+	}
+	for _, h := range c.Webhooks {
+		if h.URL != "" {
+			values = append(values, h.URL)
+		}
+	}
+	return
+}
+
+func (c *Config) Encrypted() bool {
+	return isEncrypted(c.secretFields())
+}
+
+func (c *Config) Encrypt(passphrase string) error {
+	return encryptFields(c.secretFields(), passphrase)
+}
+
+func (c *Config) Decrypt(passphrase string) error {
+	return decryptFields(c.secretFields(), passphrase)
+}
+
+func (s *Secrets) Encrypt(passphrase string) error {
+	return encryptFields(s.fields(), passphrase)
+}
+
+func isEncrypted(fields []*string) bool {
+	for _, v := range fields {
+		if strings.HasPrefix(*v, encryptedPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func encryptFields(fields []*string, passphrase string) error {
+	for _, v := range fields {
+		if *v == "" || strings.HasPrefix(*v, encryptedPrefix) {
+			continue
+		}
+		enc, e := EncryptSecret(*v, passphrase)
+		if e != nil {
+			return e
+		}
+		*v = enc
+	}
+	return nil
+}
+
+func decryptFields(fields []*string, passphrase string) error {
+	for _, v := range fields {
+		if !strings.HasPrefix(*v, encryptedPrefix) {
+			continue
+		}
+		dec, e := DecryptSecret(*v, passphrase)
+		if e != nil {
+			return e
+		}
+		*v = dec
+	}
+	return nil
+}
+
+func secretCipher(passphrase string, salt []byte) (cipher.AEAD, error) {
+	key, e := pbkdf2.Key(sha256.New, passphrase, salt, kdfIterations, 32)
+	if e != nil {
+		return nil, e
+	}
+	block, e := aes.NewCipher(key)
+	if e != nil {
+		return nil, e
+	}
+	return cipher.NewGCM(block)
+}
+
+func EncryptSecret(value, passphrase string) (string, error) {
+	salt := make([]byte, 16)
+	rand.Read(salt)
+	aead, e := secretCipher(passphrase, salt)
+	if e != nil {
+		return "", e
+	}
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	data := aead.Seal(append(salt, nonce...), nonce, []byte(value), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func DecryptSecret(value, passphrase string) (string, error) {
+	data, e := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if e != nil || len(data) < 16 {
+		return "", ErrWrongPassphrase
+	}
+	aead, e := secretCipher(passphrase, data[:16])
+	if e != nil {
+		return "", e
+	}
+	data = data[16:]
+	if len(data) < aead.NonceSize() {
+		return "", ErrWrongPassphrase
+	}
+	plain, e := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if e != nil {
+		return "", ErrWrongPassphrase
+	}
+	return string(plain), nil
+}
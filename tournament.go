@@ -0,0 +1,69 @@
+package osubot
+
+import (
+	"os"
+	"fmt"
+	"errors"
+	"strings"
+	"encoding/json"
+)
+
+type Tournament struct {
+	Teams [2]Team           `json:"teams"`
+	BestOf int              `json:"best_of"`
+	PickTime int            `json:"pick_time"`
+	NoFail bool             `json:"no_fail"`
+	Mappool map[string]int  `json:"mappool"`
+	Order []TournamentStep  `json:"order"`
+}
+
+type Team struct {
+	Name string      `json:"name"`
+	Captain string   `json:"captain"`
+	Players []string `json:"players"`
+}
+
+type TournamentStep struct {
+	Team int      `json:"team"`
+	Action string `json:"action"`
+}
+
+func (t *Tournament) LoadFile(path string) error {
+	b, e := os.ReadFile(path)
+	if e != nil {
+		return e
+	}
+	if e = json.Unmarshal(b, t); e != nil {
+		return fmt.Errorf("%v: %w", path, e)
+	}
+	return nil
+}
+
+func (t Tournament) Validate() error {
+	var errs []error
+	check := func(ok bool, field, msg string, args ...any) {
+		if !ok {
+			errs = append(errs, FieldError{ field, fmt.Sprintf(msg, args...) })
+		}
+	}
+
+	for i, team := range t.Teams {
+		check(team.Name != "", fmt.Sprintf("teams[%v].name", i), "must not be empty")
+		check(team.Captain != "", fmt.Sprintf("teams[%v].captain", i), "must not be empty")
+	}
+	check(t.BestOf > 0 && t.BestOf % 2 == 1, "best_of", "must be a positive odd number, got %v", t.BestOf)
+	check(t.PickTime >= 0, "pick_time", "must not be negative")
+
+	check(len(t.Mappool) > 0, "mappool", "must not be empty")
+	for slot, id := range t.Mappool {
+		check(slot == strings.ToUpper(slot), "mappool." + slot, "slot names must be upper case")
+		check(id > 0, "mappool." + slot, "must be a beatmap ID, got %v", id)
+	}
+
+	for i, s := range t.Order {
+		check(s.Team == 0 || s.Team == 1, fmt.Sprintf("order[%v].team", i), "must be 0 or 1, got %v", s.Team)
+		check(s.Action == "pick" || s.Action == "ban", fmt.Sprintf("order[%v].action", i), "must be pick or ban, got %q", s.Action)
+	}
+
+	return errors.Join(errs...)
+}